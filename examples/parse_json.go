@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/jmikkola/parsego/parser"
 )
@@ -15,12 +17,8 @@ func charWHS(c rune) parser.Parser {
 }
 
 func jsonString() parser.Parser {
-	hexChar := parser.Or(
-		parser.CharRange('a', 'f'),
-		parser.CharRange('A', 'F'),
-		parser.Digit())
 	unicodeEscapeSeq := parser.Sequence(
-		parser.Char('u'), hexChar, hexChar, hexChar)
+		parser.Char('u'), parser.Times(4, parser.HexDigit()))
 
 	escapedChar := parser.Sequence(
 		parser.Char('\\'),
@@ -63,32 +61,10 @@ func listParser() parser.Parser {
 	return parser.Surround(charWHS('['), values, charWHS(']'))
 }
 
-func floatParser() parser.Parser {
-	decimalPart := parser.Sequence(
-		parser.Char('.'),
-		parser.Digits())
-
-	exponentPart := parser.Sequence(
-		parser.AnyChar('e', 'E'),
-		parser.Maybe(parser.AnyChar('-', '+')),
-		parser.Digits())
-
-	floatP := parser.Sequence(
-		parser.Maybe(parser.Char('-')),
-		parser.Digits(),
-		parser.Maybe(decimalPart),
-		parser.Maybe(exponentPart))
-
-	return parser.ParseWith(
-		floatP,
-		func(floatVal interface{}) interface{} {
-			f, _ := strconv.ParseFloat(floatVal.(string), 64)
-			return f
-		})
-}
-
 func objectParser() parser.Parser {
-	pairs := parser.ManySepBy(objectPair(), charWHS(','))
+	pairs := parser.UniqueKeyMap(objectPair(), charWHS(','), func(p interface{}) string {
+		return p.(pair).key
+	})
 
 	return parser.ParseWith(
 		parser.Surround(charWHS('{'), pairs, charWHS('}')),
@@ -102,6 +78,17 @@ func objectParser() parser.Parser {
 		})
 }
 
+// numberParser parses a number. Unlike Float, JSON doesn't allow a
+// leading "+".
+func numberParser() parser.Parser {
+	return parser.Map([]parser.Named{
+		{"", parser.Not(parser.Char('+'))},
+		{"value", parser.Float()},
+	}, func(m map[string]interface{}) interface{} {
+		return m["value"]
+	})
+}
+
 func jsonParser() parser.Parser {
 	trueParser := parser.TokenAs("true", true)
 	falseParser := parser.TokenAs("false", false)
@@ -109,10 +96,41 @@ func jsonParser() parser.Parser {
 	return parser.Lazy(func() parser.Parser {
 		return parser.Or(
 			objectParser(), listParser(), trueParser, nullParser,
-			falseParser, floatParser(), jsonString())
+			falseParser, numberParser(), jsonString())
 	})
 }
 
+// renderJSON renders a parsed value as compact JSON with sorted keys.
+func renderJSON(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		members := make([]string, len(keys))
+		for i, key := range keys {
+			members[i] = strconv.Quote(key) + ":" + renderJSON(v[key])
+		}
+		return "{" + strings.Join(members, ",") + "}"
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = renderJSON(item)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
 func main() {
 	// See http://www.json.org/
 	json := `{"a key": -123.45E+8, "b": [true, false, null], "c": {"in\\ner": "yup"}}`
@@ -122,4 +140,11 @@ func main() {
 	} else {
 		fmt.Println("parsed", result)
 	}
+
+	canonical, err := parser.ParseString(parser.Canonical(jsonParser(), renderJSON), json)
+	if err != nil {
+		fmt.Println("error parsing", err)
+	} else {
+		fmt.Println("canonical", canonical)
+	}
 }
@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// BiDi is implemented by parsers that can turn a result back into text,
+// so that a grammar built from them doubles as a serializer. Char,
+// CharRange, Token, Sequence, Many, ListOf and Or are BiDi, as long as
+// the parsers they are built from are too.
+type BiDi interface {
+	Parser
+	Unparse(value interface{}) (string, error)
+}
+
+// Unparse renders a value as text with the given parser, which must be
+// BiDi. The text is parsed again to check that it gives back the value,
+// since it might not: ListOf(Digits()) renders ["1", "2"] as "12",
+// which parses as ["12"]. If it doesn't, Unparse returns an error.
+func Unparse(p Parser, value interface{}) (string, error) {
+	text, err := unparse(p, value)
+	if err != nil {
+		return "", err
+	}
+	parsed, err := ParseStringComplete(p, text)
+	if err != nil || !reflect.DeepEqual(parsed, value) {
+		return "", fmt.Errorf("can't unparse %#v: the text %q doesn't parse back to it", value, text)
+	}
+	return text, nil
+}
+
+// unparse renders a value with a parser that must be BiDi, without
+// checking that the text parses back to it.
+func unparse(p Parser, value interface{}) (string, error) {
+	b, ok := p.(BiDi)
+	if !ok {
+		return "", fmt.Errorf("parser %T can't unparse values", p)
+	}
+	return b.Unparse(value)
+}
+
+// Unparse renders a single-character string in the range.
+func (p *CharRangeParser) Unparse(value interface{}) (string, error) {
+	s, ok := value.(string)
+	rs := []rune(s)
+	if !ok || len(rs) != 1 || rs[0] < p.min || rs[0] > p.max {
+		return "", fmt.Errorf("can't unparse %#v: expected a character in the range '%c' to '%c'", value, p.min, p.max)
+	}
+	return s, nil
+}
+
+// Unparse renders the token.
+func (p *TokenParser) Unparse(value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok || (s != p.token && !(p.ignoreCase && strings.EqualFold(s, p.token))) {
+		return "", fmt.Errorf("can't unparse %#v: expected '%s'", value, p.token)
+	}
+	return s, nil
+}
+
+// Unparse renders a list with one item per parser, or a string that the
+// sequence matches in full.
+func (p *SeqParser) Unparse(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return unparseText(p, p.parsers, s)
+	}
+	items, ok := value.([]interface{})
+	if !ok || len(items) != len(p.parsers) {
+		return "", fmt.Errorf("can't unparse %#v: expected a list of %d items", value, len(p.parsers))
+	}
+	return unparseEach(items, func(i int) Parser { return p.parsers[i] })
+}
+
+// Unparse renders a list of items, or (for Many) a string that the
+// parser matches in full.
+func (p *ManyParser) Unparse(value interface{}) (string, error) {
+	if s, ok := value.(string); ok && p.combine {
+		return unparseText(p, []Parser{p.inner}, s)
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return "", fmt.Errorf("can't unparse %#v: expected a list", value)
+	}
+	return unparseEach(items, func(int) Parser { return p.inner })
+}
+
+// Unparse renders the value with the first alternative that can.
+func (p *OrParser) Unparse(value interface{}) (string, error) {
+	for _, alternative := range p.parsers {
+		if text, err := unparse(alternative, value); err == nil {
+			return text, nil
+		}
+	}
+	return "", fmt.Errorf("can't unparse %#v: no alternative matches", value)
+}
+
+// unparseEach unparses each item with the parser for its index and
+// joins the results.
+func unparseEach(items []interface{}, parserFor func(int) Parser) (string, error) {
+	var sb strings.Builder
+	for i, item := range items {
+		text, err := unparse(parserFor(i), item)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(text)
+	}
+	return sb.String(), nil
+}
+
+// unparseText handles the case where a parser's results were combined
+// into a single string. Since BiDi parsers return the text they match,
+// the string is its own rendering, as long as the parser accepts it.
+func unparseText(p Parser, parts []Parser, s string) (string, error) {
+	for _, part := range parts {
+		if _, ok := part.(BiDi); !ok {
+			return "", fmt.Errorf("parser %T can't unparse values", part)
+		}
+	}
+	parsed, err := ParseStringComplete(p, s)
+	if err != nil || parsed != s {
+		return "", fmt.Errorf("can't unparse %#v: it doesn't match the grammar", s)
+	}
+	return s, nil
+}
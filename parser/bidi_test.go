@@ -0,0 +1,57 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmikkola/parsego/parser"
+)
+
+// switchList parses lists of switch settings, like "[on;off;]".
+func switchList() parser.Parser {
+	setting := parser.Sequence(parser.Or(parser.Token("on"), parser.Token("off")), parser.Char(';'))
+	return parser.Sequence(parser.Char('['), parser.ListOf(setting), parser.Char(']'))
+}
+
+func TestUnparseRoundTrip(t *testing.T) {
+	p := switchList()
+
+	value, err := parser.ParseString(p, "[on;off;on;]")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []interface{}{"[", []interface{}{"on;", "off;", "on;"}, "]"}, value)
+
+	text, err := parser.Unparse(p, value)
+	assert.NoError(t, err, "Expected successful unparse")
+	assert.Equal(t, "[on;off;on;]", text)
+
+	built := []interface{}{"[", []interface{}{"off;"}, "]"}
+	text2, err2 := parser.Unparse(p, built)
+	assert.NoError(t, err2, "Expected successful unparse")
+	assert.Equal(t, "[off;]", text2)
+
+	value3, err3 := parser.ParseString(p, text2)
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, built, value3)
+}
+
+func TestUnparseErrors(t *testing.T) {
+	_, err := parser.Unparse(switchList(), []interface{}{"[", []interface{}{"maybe;"}, "]"})
+	assert.EqualError(t, err, `can't unparse "maybe;": it doesn't match the grammar`)
+
+	_, err2 := parser.Unparse(parser.Token("a"), "b")
+	assert.EqualError(t, err2, `can't unparse "b": expected 'a'`)
+
+	_, err3 := parser.Unparse(parser.Digits(), "12x")
+	assert.Error(t, err3, "Expected an error")
+
+	text, err4 := parser.Unparse(parser.Digits(), "123")
+	assert.NoError(t, err4, "Expected successful unparse")
+	assert.Equal(t, "123", text)
+
+	_, err5 := parser.Unparse(parser.Integer(), 7)
+	assert.Error(t, err5, "Expected an error")
+
+	_, err6 := parser.Unparse(parser.ListOf(parser.Digits()), []interface{}{"1", "2"})
+	assert.EqualError(t, err6, `can't unparse []interface {}{"1", "2"}: the text "12" doesn't parse back to it`)
+}
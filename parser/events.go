@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"github.com/jmikkola/parsego/parser/result"
+	"github.com/jmikkola/parsego/parser/scanner"
+)
+
+// EventHandler receives the events produced by ParseEvents.
+type EventHandler interface {
+	StartElement(name string)
+	Text(text string)
+	EndElement(name string)
+}
+
+type eventKind int
+
+const (
+	startEvent eventKind = iota
+	textEvent
+	endEvent
+)
+
+type event struct {
+	kind  eventKind
+	value string
+}
+
+// eventScanner sends events to a handler. Events produced while a
+// snapshot is active are held back until it is clear they won't be
+// rewound.
+type eventScanner struct {
+	scanner.Scanner
+	handler EventHandler
+	pending []event
+	marks   []int
+}
+
+// Unwrap returns the underlying scanner.
+func (s *eventScanner) Unwrap() scanner.Scanner {
+	return s.Scanner
+}
+
+// StartSnapshot takes a snapshot of the underlying scanner and the
+// pending events.
+func (s *eventScanner) StartSnapshot() {
+	s.marks = append(s.marks, len(s.pending))
+	s.Scanner.StartSnapshot()
+}
+
+// RewindSnapshot rewinds the underlying scanner and drops the events
+// produced since the snapshot.
+func (s *eventScanner) RewindSnapshot() {
+	last := len(s.marks) - 1
+	s.pending = s.pending[:s.marks[last]]
+	s.marks = s.marks[:last]
+	s.Scanner.RewindSnapshot()
+}
+
+// PopSnapshot drops the last snapshot, sending the pending events if
+// no snapshots are left.
+func (s *eventScanner) PopSnapshot() {
+	s.marks = s.marks[:len(s.marks)-1]
+	s.Scanner.PopSnapshot()
+	s.flush()
+}
+
+func (s *eventScanner) emit(kind eventKind, value string) {
+	s.pending = append(s.pending, event{kind: kind, value: value})
+	s.flush()
+}
+
+func (s *eventScanner) flush() {
+	if len(s.marks) > 0 {
+		return
+	}
+	for _, e := range s.pending {
+		switch e.kind {
+		case startEvent:
+			s.handler.StartElement(e.value)
+		case textEvent:
+			s.handler.Text(e.value)
+		case endEvent:
+			s.handler.EndElement(e.value)
+		}
+	}
+	s.pending = s.pending[:0]
+}
+
+// emitEvent sends an event to the handler of the enclosing
+// ParseEvents, if there is one.
+func emitEvent(sc scanner.Scanner, kind eventKind, value string) {
+	es, ok := findScanner(sc, func(s scanner.Scanner) bool {
+		_, ok := s.(*eventScanner)
+		return ok
+	}).(*eventScanner)
+	if ok {
+		es.emit(kind, value)
+	}
+}
+
+// ParseEvents parses the string, sending the events produced by AsNode
+// and AsText to the handler as parsing progresses rather than building
+// up a result. Events from input that the parser later backtracks over
+// are never sent.
+func ParseEvents(p Parser, str string, handler EventHandler) error {
+	es := &eventScanner{Scanner: NewSession(str), handler: handler}
+	r := p.Parse(es)
+	return r.Error()
+}
+
+// NodeParser produces start and end events around a parser.
+type NodeParser struct {
+	name  string
+	inner Parser
+}
+
+// AsNode returns a parser that, under ParseEvents, sends a start event
+// before running the inner parser and an end event if it matches.
+// Otherwise it behaves just like the inner parser.
+func AsNode(name string, inner Parser) Parser {
+	return &NodeParser{name: name, inner: inner}
+}
+
+// Parse parses the input.
+func (p *NodeParser) Parse(sc scanner.Scanner) result.ParseResult {
+	emitEvent(sc, startEvent, p.name)
+	r := p.inner.Parse(sc)
+	if r.Matched() {
+		emitEvent(sc, endEvent, p.name)
+	}
+	return r
+}
+
+// TextParser produces a text event for the text a parser matched.
+type TextParser struct {
+	inner Parser
+}
+
+// AsText returns a parser that, under ParseEvents, sends a text event
+// with the text matched by the inner parser. Otherwise it behaves just
+// like the inner parser.
+func AsText(inner Parser) Parser {
+	return &TextParser{inner}
+}
+
+// Parse parses the input.
+func (p *TextParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r, text := parseRecorded(p.inner, sc)
+	if r.Matched() {
+		emitEvent(sc, textEvent, string(text))
+	}
+	return r
+}
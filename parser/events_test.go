@@ -0,0 +1,58 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmikkola/parsego/parser"
+)
+
+type eventLog struct {
+	events []string
+}
+
+func (l *eventLog) StartElement(name string) { l.events = append(l.events, "start "+name) }
+func (l *eventLog) Text(text string)         { l.events = append(l.events, "text "+text) }
+func (l *eventLog) EndElement(name string)   { l.events = append(l.events, "end "+name) }
+
+func TestParseEvents(t *testing.T) {
+	var item parser.Parser
+	item = parser.Lazy(func() parser.Parser {
+		list := parser.AsNode("list", parser.Surround(
+			parser.Char('['),
+			parser.ManySepBy(item, parser.Char(',')),
+			parser.Char(']')))
+		// The first alternative backtracks, so its events must not be sent
+		pair := parser.AsNode("pair", parser.Sequence(parser.Digits(), parser.Char(':')))
+		return parser.Or(list, pair, parser.AsText(parser.Digits()))
+	})
+
+	log := &eventLog{}
+	err := parser.ParseEvents(item, "[1,[2,3]]", log)
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []string{
+		"start list",
+		"text 1",
+		"start list",
+		"text 2",
+		"text 3",
+		"end list",
+		"end list",
+	}, log.events)
+
+	err2 := parser.ParseEvents(item, "[1,", &eventLog{})
+	assert.Error(t, err2, "Expected error")
+}
+
+func TestParseEventsWithRules(t *testing.T) {
+	// The rule is tried again at the same position after the first
+	// alternative fails, so its events must be sent from the retry
+	rule := parser.Rule("num", parser.AsNode("num", parser.AsText(parser.Digits())))
+	p := parser.Or(parser.Sequence(rule, parser.Char('!')), rule)
+
+	log := &eventLog{}
+	err := parser.ParseEvents(p, "12", log)
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []string{"start num", "text 12", "end num"}, log.events)
+}
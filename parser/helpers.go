@@ -1,10 +1,63 @@
 package parser
 
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
 // Digit parses a single digit.
 func Digit() Parser {
 	return CharRange('0', '9')
 }
 
+// HexDigit parses a single hexadecimal digit (upper or lower case).
+func HexDigit() Parser {
+	return Or(Digit(), CharRange('a', 'f'), CharRange('A', 'F'))
+}
+
+// OctDigit parses a single octal digit.
+func OctDigit() Parser {
+	return CharRange('0', '7')
+}
+
+// BinDigit parses a single binary digit.
+func BinDigit() Parser {
+	return AnyChar('0', '1')
+}
+
+// HexNumber parses one or more hexadecimal digits, like "ff", returning
+// the value as an int64.
+func HexNumber() Parser {
+	return MapE(Many1(HexDigit()), parseIntBase(16))
+}
+
+// OctNumber parses one or more octal digits, like "0755", returning the
+// value as an int64.
+func OctNumber() Parser {
+	return MapE(Many1(OctDigit()), parseIntBase(8))
+}
+
+// BinNumber parses one or more binary digits, like "1010", returning
+// the value as an int64.
+func BinNumber() Parser {
+	return MapE(Many1(BinDigit()), parseIntBase(2))
+}
+
+// parseIntBase returns a function that converts a string result in the
+// given base to an int64.
+func parseIntBase(base int) func(interface{}) (interface{}, error) {
+	return func(text interface{}) (interface{}, error) {
+		n, err := strconv.ParseInt(text.(string), base, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base %d number '%s'", base, text)
+		}
+		return n, nil
+	}
+}
+
 // LowerLetter parses a single lower case letter.
 func LowerLetter() Parser {
 	return CharRange('a', 'z')
@@ -68,14 +121,211 @@ func ManySepBy(inner, separator Parser) Parser {
 		})
 }
 
+// Many1SepByTrailing works like Many1SepBy, but also allows a
+// separator after the last item, e.g. "1,2,3,".
+func Many1SepByTrailing(inner, separator Parser) Parser {
+	return Map([]Named{
+		{"items", Many1SepBy(inner, separator)},
+		{"", Maybe(separator)},
+	}, func(m map[string]interface{}) interface{} {
+		return m["items"]
+	})
+}
+
+// ManySepByTrailing works like ManySepBy, but also allows a separator
+// after the last item. A separator on its own is not allowed.
+func ManySepByTrailing(inner, separator Parser) Parser {
+	return ParseWith(
+		Maybe(Many1SepByTrailing(inner, separator)),
+		func(inner interface{}) interface{} {
+			if _, ok := inner.([]interface{}); ok {
+				return inner
+			}
+			return []interface{}{}
+		})
+}
+
+// EndBy parses 0+ things that are each followed by some terminator,
+// like "1;2;3;", returning a list of just the things.
+func EndBy(inner, terminator Parser) Parser {
+	return ListOf(endedBy(inner, terminator))
+}
+
+// EndBy1 works like EndBy, but requires at least one thing.
+func EndBy1(inner, terminator Parser) Parser {
+	item := endedBy(inner, terminator)
+	return Map([]Named{
+		{"first", item},
+		{"rest", ListOf(item)},
+	}, func(m map[string]interface{}) interface{} {
+		return append([]interface{}{m["first"]}, m["rest"].([]interface{})...)
+	})
+}
+
+// endedBy parses a thing followed by a terminator, returning the thing.
+func endedBy(inner, terminator Parser) Parser {
+	return Map([]Named{
+		{"inner", inner},
+		{"", terminator},
+	}, func(m map[string]interface{}) interface{} {
+		return m["inner"]
+	})
+}
+
+// ManyTill parses the inner parser zero or more times until the end
+// parser matches, like ManyTillAny with a single terminator. The end
+// is consumed, and the results are combined like Many's.
+func ManyTill(inner, end Parser) Parser {
+	return ParseWith(ManyTillAny(inner, end), func(terminated interface{}) interface{} {
+		return cleanupResult(terminated.(Terminated).Items)
+	})
+}
+
+// Verbatim parses open, then everything up to the next match of close,
+// returning the text in between exactly as written. Nothing inside is
+// skipped, so it can be used for regions where whitespace matters, like
+// code spans in a grammar that otherwise skips whitespace between
+// tokens. The close delimiter is consumed but not included.
+func Verbatim(open, close Parser) Parser {
+	return Map([]Named{
+		{"", open},
+		{"text", ManyTill(NoneOf(), close)},
+	}, func(m map[string]interface{}) interface{} {
+		return m["text"]
+	})
+}
+
 // Digits parses one or more digits.
 func Digits() Parser {
 	return Many1(Digit())
 }
 
+// Integer parses one or more digits, returning them as an int. It
+// fails if the number is too large for an int.
+func Integer() Parser {
+	return MapE(Digits(), atoi)
+}
+
+// SignedInteger works like Integer, but allows a leading "-" or "+".
+func SignedInteger() Parser {
+	return MapE(signedIntegerText(), atoi)
+}
+
+// IntInRange returns a parser for a decimal integer with an optional
+// sign, returning it as an int64. It fails if the value is outside of
+// [min, max] (inclusive).
+func IntInRange(min, max int64) Parser {
+	return MapE(signedIntegerText(), func(text interface{}) (interface{}, error) {
+		n, err := strconv.ParseInt(text.(string), 10, 64)
+		if err != nil || n < min || n > max {
+			return nil, fmt.Errorf("value %s out of range [%d, %d]", text, min, max)
+		}
+		return n, nil
+	})
+}
+
+// signedIntegerText matches the text of an integer with an optional
+// sign, like "-42".
+func signedIntegerText() Parser {
+	return Sequence(Maybe(AnyChar('-', '+')), Digits())
+}
+
+// atoi converts a string result to an int.
+func atoi(text interface{}) (interface{}, error) {
+	n, err := strconv.Atoi(text.(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid integer '%s'", text)
+	}
+	return n, nil
+}
+
+// GroupedInteger parses a number written with group separators, like
+// "1,234,567", returning it as an int64 with the separators removed.
+// Every group after the first must have exactly three digits, and the
+// first must have one to three. A number without any separators is
+// also accepted.
+func GroupedInteger(groupSep rune) Parser {
+	group := Map([]Named{
+		{"", Char(groupSep)},
+		{"digits", Digits()},
+	}, func(m map[string]interface{}) interface{} {
+		return m["digits"]
+	})
+	groups := Map([]Named{
+		{"first", Digits()},
+		{"rest", ListOf(group)},
+	}, func(m map[string]interface{}) interface{} {
+		return append([]interface{}{m["first"]}, m["rest"].([]interface{})...)
+	})
+
+	return MapE(groups, func(value interface{}) (interface{}, error) {
+		gs := value.([]interface{})
+		var digits strings.Builder
+		for i, g := range gs {
+			text := g.(string)
+			if len(gs) > 1 && ((i == 0 && len(text) > 3) || (i > 0 && len(text) != 3)) {
+				return nil, fmt.Errorf("digit group '%s' has the wrong size", text)
+			}
+			digits.WriteString(text)
+		}
+		n, err := strconv.ParseInt(digits.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer '%s'", digits.String())
+		}
+		return n, nil
+	})
+}
+
+// Float parses a number with an optional sign, fractional part and
+// exponent, like "-2.5E-3", returning it as a float64.
+func Float() Parser {
+	return MapE(numberText(), func(text interface{}) (interface{}, error) {
+		f, err := strconv.ParseFloat(text.(string), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", text)
+		}
+		return f, nil
+	})
+}
+
+// numberText matches the text of a number, like "-2.5E-3".
+func numberText() Parser {
+	return Sequence(
+		signedIntegerText(),
+		Maybe(Sequence(Char('.'), Digits())),
+		Maybe(Sequence(AnyChar('e', 'E'), Maybe(AnyChar('-', '+')), Digits())))
+}
+
+// RunLength parses one or more of the given rune in a row, returning
+// how many there were as an int. E.g. RunLength('#') gives the level of
+// a Markdown heading.
+func RunLength(c rune) Parser {
+	return ParseWith(Many1(Char(c)), func(run interface{}) interface{} {
+		return len([]rune(run.(string)))
+	})
+}
+
+// Line parses the rest of the current line, up to (but not including)
+// the next newline.
+func Line() Parser {
+	return TakeUntil(func(r rune) bool { return r == '\n' })
+}
+
 // WhitespaceChar parses a single whitespace character
 func WhitespaceChar() Parser {
-	return AnyChar(' ', '\n', '\t', '\b', '\v')
+	return AnyChar(' ', '\n', '\t', '\v')
+}
+
+// UnicodeWhitespaceChar parses a single Unicode whitespace character,
+// as defined by unicode.IsSpace. This includes characters like the
+// non-breaking space and the em space.
+func UnicodeWhitespaceChar() Parser {
+	return &PredicateParser{pred: unicode.IsSpace, description: "whitespace"}
+}
+
+// UnicodeWhitespace parses zero or more Unicode whitespace characters
+func UnicodeWhitespace() Parser {
+	return Many(UnicodeWhitespaceChar())
 }
 
 // Whitespace parses zero or more whitespace characters
@@ -101,6 +351,27 @@ func TokenAs(token string, value interface{}) Parser {
 	return ParseAs(Token(token), value)
 }
 
+// FlexibleList parses a list of items separated by commas, newlines,
+// or any mix of the two, like a list in a hand-edited config file.
+// Consecutive separators count as one, spaces and tabs around them are
+// skipped, and separators are allowed before the first item and after
+// the last. The result is a []interface{}.
+func FlexibleList(inner Parser) Parser {
+	blank := Many(AnyChar(' ', '\t', '\r'))
+	separator := Many1(Sequence(blank, AnyChar(',', '\n'), blank))
+	return Surround(Maybe(separator), ManySepByTrailing(inner, separator), Whitespace())
+}
+
+// QuotedString parses text between a pair of quote runes, where the
+// escape rune makes the rune after it part of the string, so `"a\"b"`
+// is a single string. The result is the raw text between the quotes,
+// with the escape runes left in; decoding it is up to the caller.
+func QuotedString(quote, escape rune) Parser {
+	escaped := Sequence(Char(escape), NoneOf())
+	body := Many(Or(escaped, NoneOf(quote, escape)))
+	return Surround(Char(quote), body, Char(quote))
+}
+
 // Surround surrounds the inner parser with the left and right
 // parsers, but then returns the value from just the inner parser.
 func Surround(left, inner, right Parser) Parser {
@@ -112,3 +383,337 @@ func Surround(left, inner, right Parser) Parser {
 		return m["inner"]
 	})
 }
+
+// Delimited parses open, inner and close in series, returning just the
+// result of inner. It is the same as Surround.
+func Delimited(open, inner, close Parser) Parser {
+	return Surround(open, inner, close)
+}
+
+// Between parses inner between the open and close characters, like
+// "(42)", returning just the result of inner.
+func Between(open, close rune, inner Parser) Parser {
+	return Surround(Char(open), inner, Char(close))
+}
+
+// FoldSepBy parses 1+ things separated by some separator, like
+// Many1SepBy, but folds the results from left to right with the
+// combine function instead of returning a list. E.g. folding "a.b.c"
+// produces combine(combine("a", "b"), "c").
+func FoldSepBy(inner, separator Parser, combine func(left, right interface{}) interface{}) Parser {
+	return ParseWith(
+		Many1SepBy(inner, separator),
+		func(items interface{}) interface{} {
+			list := items.([]interface{})
+			acc := list[0]
+			for _, item := range list[1:] {
+				acc = combine(acc, item)
+			}
+			return acc
+		})
+}
+
+// OrNodes works like Or, and is meant for alternatives that each
+// produce a different node type implementing some shared interface.
+// The result keeps the dynamic type of the value produced by whichever
+// alternative matched, so it can be dispatched on with TypeSwitch.
+func OrNodes(alts ...Parser) Parser {
+	return Or(alts...)
+}
+
+// TypeSwitch builds a function (for use with ParseWith) that calls the
+// handler registered for the dynamic type of the value it is given.
+// It panics if there is no handler for that type, since that means an
+// alternative returned a node type the grammar didn't expect.
+func TypeSwitch(handlers map[reflect.Type]func(interface{}) interface{}) func(interface{}) interface{} {
+	return func(value interface{}) interface{} {
+		handler, ok := handlers[reflect.TypeOf(value)]
+		if !ok {
+			panic(fmt.Sprintf("parser: TypeSwitch has no handler for type %T", value))
+		}
+		return handler(value)
+	}
+}
+
+// Version is a semantic version, as returned by SemVer.
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          string
+}
+
+// SemVer parses a semantic version like "1.2.3" or "1.0.0-beta.1",
+// returning a Version.
+func SemVer() Parser {
+	number := Integer()
+	prerelease := Maybe(Sequence(
+		Ignore(Char('-')),
+		Many1(Or(AlphaNum(), AnyChar('.', '-')))))
+	return Map([]Named{
+		{"major", number},
+		{"", Char('.')},
+		{"minor", number},
+		{"", Char('.')},
+		{"patch", number},
+		{"prerelease", prerelease},
+	}, func(m map[string]interface{}) interface{} {
+		return Version{
+			Major:      m["major"].(int),
+			Minor:      m["minor"].(int),
+			Patch:      m["patch"].(int),
+			Prerelease: m["prerelease"].(string),
+		}
+	})
+}
+
+// Constraint is a single version constraint like ">=1.2.0".
+type Constraint struct {
+	Op      string // one of "^", "~", ">=", ">", "<=", "<", "="
+	Version Version
+}
+
+// VersionRange parses a list of version constraints separated by
+// whitespace or commas, like ">=1.2.0 <2.0.0", returning a
+// []interface{} of Constraint values. A version without an operator
+// is treated as "=".
+func VersionRange() Parser {
+	op := Or(
+		Token("^"), Token("~"), Token(">="), Token(">"),
+		Token("<="), Token("<"), Token("="))
+	constraint := Map([]Named{
+		{"op", Maybe(op)},
+		{"", Whitespace()},
+		{"version", SemVer()},
+	}, func(m map[string]interface{}) interface{} {
+		op := m["op"].(string)
+		if op == "" {
+			op = "="
+		}
+		return Constraint{Op: op, Version: m["version"].(Version)}
+	})
+	separator := Or(
+		Sequence(Whitespace(), Char(','), Whitespace()),
+		Whitespace1())
+	return Many1SepBy(constraint, separator)
+}
+
+// SpacedNumber parses a number surrounded by optional whitespace, like
+// "  42  ". Numbers with a fractional part or an exponent (or that are
+// too large for an int) are returned as a float64, others as an int.
+func SpacedNumber() Parser {
+	integer := Map([]Named{
+		{"n", SignedInteger()},
+		{"", Not(AnyChar('.', 'e', 'E'))},
+	}, func(m map[string]interface{}) interface{} {
+		return m["n"]
+	})
+	return Surround(Whitespace(), Or(integer, Float()), Whitespace())
+}
+
+// Canonical runs the inner parser and renders its result back to text
+// with the render function, returning the normalized string. This
+// turns a parser into a formatter for the language it accepts.
+func Canonical(inner Parser, render func(interface{}) string) Parser {
+	return ParseWith(inner, func(value interface{}) interface{} {
+		return render(value)
+	})
+}
+
+// BracketedList parses a list of elements separated by commas between
+// the open and close characters, like "[1, 2, 3]", returning a
+// []interface{} of the elements. Whitespace is allowed around the
+// elements, and the last element may be followed by a comma.
+func BracketedList(open, close rune, element Parser) Parser {
+	return Map([]Named{
+		{"", Char(open)},
+		{"items", ManySepByTrailing(Surround(Whitespace(), element, Whitespace()), Char(','))},
+		{"", Whitespace()},
+		{"", Char(close)},
+	}, func(m map[string]interface{}) interface{} {
+		return m["items"]
+	})
+}
+
+// ChainLeft1 parses one or more operands separated by operators, where
+// the op parser returns a func(left, right interface{}) interface{}
+// that combines the operands on either side of it. The operands are
+// combined from left to right, so "1-2-3" is treated as (1-2)-3.
+func ChainLeft1(operand, op Parser) Parser {
+	step := Map([]Named{
+		{"op", op},
+		{"right", operand},
+	}, func(m map[string]interface{}) interface{} {
+		return m
+	})
+	return Map([]Named{
+		{"left", operand},
+		{"steps", ListOf(step)},
+	}, func(m map[string]interface{}) interface{} {
+		acc := m["left"]
+		for _, item := range m["steps"].([]interface{}) {
+			parsed := item.(map[string]interface{})
+			combine := parsed["op"].(func(left, right interface{}) interface{})
+			acc = combine(acc, parsed["right"])
+		}
+		return acc
+	})
+}
+
+// ChainRight1 works like ChainLeft1, but combines the operands from
+// right to left, so "2^3^4" is treated as 2^(3^4). With a single
+// operand, the result is just that operand.
+func ChainRight1(operand, op Parser) Parser {
+	var chain Parser
+	rest := Map([]Named{
+		{"op", op},
+		{"right", Lazy(func() Parser { return chain })},
+	}, func(m map[string]interface{}) interface{} {
+		return m
+	})
+	chain = Map([]Named{
+		{"left", operand},
+		{"rest", Maybe(rest)},
+	}, func(m map[string]interface{}) interface{} {
+		parsed, ok := m["rest"].(map[string]interface{})
+		if !ok {
+			return m["left"]
+		}
+		combine := parsed["op"].(func(left, right interface{}) interface{})
+		return combine(m["left"], parsed["right"])
+	})
+	return chain
+}
+
+// OperatorLevel describes one precedence level of left-associative
+// binary operators for GroupedExpression. Operator parses any of the
+// operators at this level, and Combine builds the value for "left op
+// right" from the operator's result and the two operands.
+type OperatorLevel struct {
+	Operator Parser
+	Combine  func(op, left, right interface{}) interface{}
+}
+
+// GroupedExpression builds a parser for expressions made of terms and
+// binary operators, where a sub-expression between open and close can
+// be used anywhere a term can. Levels are ordered from the tightest
+// binding to the loosest, so for arithmetic "*" comes before "+".
+func GroupedExpression(term, open, close Parser, levels []OperatorLevel) Parser {
+	var expr Parser
+	group := Surround(open, Lazy(func() Parser { return expr }), close)
+	operand := Or(group, term)
+	for _, level := range levels {
+		operand = operatorLevel(operand, level)
+	}
+	expr = operand
+	return expr
+}
+
+// operatorLevel parses operands separated by the operators of a
+// single level, folding them from left to right.
+func operatorLevel(operand Parser, level OperatorLevel) Parser {
+	op := ParseWith(level.Operator, func(op interface{}) interface{} {
+		return func(left, right interface{}) interface{} {
+			return level.Combine(op, left, right)
+		}
+	})
+	return ChainLeft1(operand, op)
+}
+
+// DetectBOM parses an optional byte order mark at the start of the
+// input, returning the name of the encoding it indicates ("UTF-8",
+// "UTF-16BE", "UTF-16LE", "UTF-32BE" or "UTF-32LE"), or "none" if
+// there isn't one.
+//
+// A UTF-8 BOM is usually seen as the rune U+FEFF. The other marks are
+// not valid UTF-8, so they can only be detected when each byte of the
+// input was read as one rune (e.g. decoded as Latin-1).
+func DetectBOM() Parser {
+	return Or(
+		ParseAs(Char('\ufeff'), "UTF-8"),
+		ParseAs(Token("\u00ef\u00bb\u00bf"), "UTF-8"),
+		ParseAs(Token("\x00\x00\u00fe\u00ff"), "UTF-32BE"),
+		ParseAs(Token("\u00ff\u00fe\x00\x00"), "UTF-32LE"),
+		ParseAs(Token("\u00fe\u00ff"), "UTF-16BE"),
+		ParseAs(Token("\u00ff\u00fe"), "UTF-16LE"),
+		ParseAs(Token(""), "none"))
+}
+
+// Identifier parses a typical programming language name: a letter or
+// underscore followed by letters, digits and underscores.
+func Identifier() Parser {
+	return IdentifierWith(Or(Letter(), AnyChar('_')), Or(Letter(), Digit(), AnyChar('_')))
+}
+
+// IdentifierWith parses a name made of one character matched by start
+// followed by any number matched by rest, returning it as a string.
+func IdentifierWith(start, rest Parser) Parser {
+	return Sequence(start, Many(rest))
+}
+
+// IdentifierToken is the result of KeywordOrIdentifier.
+type IdentifierToken struct {
+	IsKeyword bool
+	Text      string
+}
+
+// KeywordOrIdentifier parses the longest identifier it can (a letter
+// or underscore followed by letters, digits and underscores), then
+// classifies it as a keyword if it is in the given set, returning an
+// IdentifierToken. Since the whole identifier is read first, "ifx" is
+// an identifier even if "if" is a keyword.
+func KeywordOrIdentifier(keywords map[string]struct{}) Parser {
+	return ParseWith(Identifier(), func(text interface{}) interface{} {
+		_, isKeyword := keywords[text.(string)]
+		return IdentifierToken{IsKeyword: isKeyword, Text: text.(string)}
+	})
+}
+
+// AnnotatedValue is the result of Annotated.
+type AnnotatedValue struct {
+	Value       interface{}
+	Annotations []interface{}
+}
+
+// Annotated parses a value followed by zero or more annotations, like
+// "value @deprecated @since(1.2)", returning an AnnotatedValue.
+// Whitespace before each annotation is skipped.
+func Annotated(value, annotation Parser) Parser {
+	annotations := ListOf(Map([]Named{
+		{"", Whitespace()},
+		{"annotation", annotation},
+	}, func(m map[string]interface{}) interface{} {
+		return m["annotation"]
+	}))
+	return Map([]Named{
+		{"value", value},
+		{"annotations", annotations},
+	}, func(m map[string]interface{}) interface{} {
+		return AnnotatedValue{
+			Value:       m["value"],
+			Annotations: m["annotations"].([]interface{}),
+		}
+	})
+}
+
+// LogField describes one field of a log line for LogLine.
+type LogField struct {
+	Name      string
+	Parser    Parser
+	Separator Parser // parsed after the field; may be nil
+}
+
+// LogLine parses a line made of the given fields in order, like a
+// "timestamp level message" log line, returning a map from each
+// field's name to its result. If a field doesn't match, the error
+// names that field.
+func LogLine(fields []LogField) Parser {
+	parts := []Named{}
+	for _, field := range fields {
+		parts = append(parts, Named{field.Name, Label(field.Name, field.Parser)})
+		if field.Separator != nil {
+			parts = append(parts, Named{"", field.Separator})
+		}
+	}
+	return Map(parts, func(m map[string]interface{}) interface{} {
+		return m
+	})
+}
@@ -1,6 +1,10 @@
 package parser_test
 
 import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -64,3 +68,747 @@ func TestManySepBy(t *testing.T) {
 	assert.NoError(t, err3, "Expected successful parse")
 	assert.Equal(t, []interface{}{"12", "34", "56"}, result3)
 }
+
+func TestManySepByTrailing(t *testing.T) {
+	p := parser.Sequence(parser.ManySepByTrailing(parser.Digits(), parser.Char(',')), parser.EOF())
+
+	result1, err1 := parser.ParseString(p, "")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []interface{}{[]interface{}{}, ""}, result1)
+
+	result2, err2 := parser.ParseString(p, "1,2,3,")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{[]interface{}{"1", "2", "3"}, ""}, result2)
+
+	result3, err3 := parser.ParseString(p, "1,")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, []interface{}{[]interface{}{"1"}, ""}, result3)
+
+	expectFails(t, p, ",1")
+	expectFails(t, p, ",")
+	expectFails(t, p, "1,,")
+}
+
+func TestMany1SepByTrailing(t *testing.T) {
+	p := parser.Many1SepByTrailing(parser.Digits(), parser.Char(','))
+
+	result1, err1 := parser.ParseString(p, "1,2,3,")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []interface{}{"1", "2", "3"}, result1)
+
+	result2, err2 := parser.ParseString(p, "1,")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{"1"}, result2)
+
+	expectFails(t, p, ",1")
+	expectFails(t, p, "")
+}
+
+func TestEndBy(t *testing.T) {
+	p := parser.Sequence(parser.EndBy(parser.Digits(), parser.Char(';')), parser.EOF())
+
+	result1, err1 := parser.ParseString(p, "1;2;3;")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []interface{}{[]interface{}{"1", "2", "3"}, ""}, result1)
+
+	result2, err2 := parser.ParseString(p, "")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{[]interface{}{}, ""}, result2)
+
+	expectFails(t, p, "1;2")
+}
+
+func TestEndBy1(t *testing.T) {
+	p := parser.EndBy1(parser.Digits(), parser.Char(';'))
+
+	result1, err1 := parser.ParseString(p, "1;2;3;")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []interface{}{"1", "2", "3"}, result1)
+
+	result2, err2 := parser.ParseString(p, "1;")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{"1"}, result2)
+
+	expectFails(t, p, "")
+	expectFails(t, p, "1")
+	expectFails(t, parser.Sequence(p, parser.EOF()), "1;2")
+}
+
+func TestManyTill(t *testing.T) {
+	p := parser.Sequence(parser.Token("/*"), parser.ManyTill(parser.AnyCharIn("abc*/ "), parser.Token("*/")))
+
+	result1, err1 := parser.ParseString(parser.Sequence(p, parser.Token(" c")), "/* a*b / c */ c */")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "/* a*b / c  c", result1, "Expected the first */ to end the comment")
+
+	result2, err2 := parser.ParseString(p, "/**/")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "/*", result2)
+
+	expectFails(t, p, "/* abc")
+
+	items := parser.ManyTill(parser.SpacedNumber(), parser.Char(';'))
+	result3, err3 := parser.ParseString(items, "1 2 ;")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, []interface{}{1, 2}, result3)
+}
+
+func TestBetween(t *testing.T) {
+	p := parser.Between('(', ')', parser.Digits())
+
+	result, err := parser.ParseString(p, "(42)")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "42", result)
+
+	expectFails(t, p, "(42")
+	expectFails(t, p, "42)")
+}
+
+func TestDelimited(t *testing.T) {
+	p := parser.Delimited(parser.Token("<!--"), parser.Many(parser.NoneOf('-')), parser.Token("-->"))
+
+	result, err := parser.ParseString(p, "<!-- note -->")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, " note ", result)
+
+	expectFails(t, p, "<!-- note")
+}
+
+type access struct {
+	left, right interface{}
+}
+
+func TestFoldSepBy(t *testing.T) {
+	p := parser.FoldSepBy(
+		parser.Many1(parser.Letter()),
+		parser.Char('.'),
+		func(left, right interface{}) interface{} {
+			return access{left, right}
+		})
+
+	result1, err1 := parser.ParseString(p, "a.b.c")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, access{access{"a", "b"}, "c"}, result1)
+
+	result2, err2 := parser.ParseString(p, "a")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "a", result2)
+}
+
+type node interface {
+	describe() string
+}
+
+type numberNode struct{ digits string }
+type nameNode struct{ name string }
+
+func (n numberNode) describe() string { return "number " + n.digits }
+func (n nameNode) describe() string   { return "name " + n.name }
+
+func TestOrNodes(t *testing.T) {
+	number := parser.ParseWith(parser.Digits(), func(v interface{}) interface{} {
+		return numberNode{v.(string)}
+	})
+	name := parser.ParseWith(parser.Many1(parser.Letter()), func(v interface{}) interface{} {
+		return nameNode{v.(string)}
+	})
+	p := parser.ParseWith(parser.OrNodes(number, name), parser.TypeSwitch(
+		map[reflect.Type]func(interface{}) interface{}{
+			reflect.TypeOf(numberNode{}): func(v interface{}) interface{} {
+				return v.(node).describe()
+			},
+			reflect.TypeOf(nameNode{}): func(v interface{}) interface{} {
+				return v.(node).describe()
+			},
+		}))
+
+	result1, err1 := parser.ParseString(p, "123")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "number 123", result1)
+
+	result2, err2 := parser.ParseString(p, "abc")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "name abc", result2)
+
+	unhandled := parser.ParseWith(parser.OrNodes(number, name), parser.TypeSwitch(
+		map[reflect.Type]func(interface{}) interface{}{
+			reflect.TypeOf(numberNode{}): func(v interface{}) interface{} {
+				return v.(node).describe()
+			},
+		}))
+	assert.Panics(t, func() {
+		parser.ParseString(unhandled, "abc")
+	})
+}
+
+func TestSemVer(t *testing.T) {
+	result, err := parser.ParseString(parser.SemVer(), "1.20.3-beta.1")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, parser.Version{Major: 1, Minor: 20, Patch: 3, Prerelease: "beta.1"}, result)
+
+	expectFails(t, parser.SemVer(), "1.2")
+}
+
+func TestVersionRange(t *testing.T) {
+	result1, err1 := parser.ParseString(parser.VersionRange(), ">=1.2.0 <2.0.0")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []interface{}{
+		parser.Constraint{Op: ">=", Version: parser.Version{Major: 1, Minor: 2}},
+		parser.Constraint{Op: "<", Version: parser.Version{Major: 2}},
+	}, result1)
+
+	result2, err2 := parser.ParseString(parser.VersionRange(), "^1.4.2")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{
+		parser.Constraint{Op: "^", Version: parser.Version{Major: 1, Minor: 4, Patch: 2}},
+	}, result2)
+
+	result3, err3 := parser.ParseString(parser.VersionRange(), "~0.3.1, = 0.3.5, 1.0.0")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, []interface{}{
+		parser.Constraint{Op: "~", Version: parser.Version{Minor: 3, Patch: 1}},
+		parser.Constraint{Op: "=", Version: parser.Version{Minor: 3, Patch: 5}},
+		parser.Constraint{Op: "=", Version: parser.Version{Major: 1}},
+	}, result3)
+
+	expectFails(t, parser.VersionRange(), "=>1.2.0")
+	expectFails(t, parser.VersionRange(), "!1.2.0")
+}
+
+func TestSpacedNumber(t *testing.T) {
+	result1, err1 := parser.ParseString(parser.SpacedNumber(), "  42  ")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, 42, result1)
+
+	result2, err2 := parser.ParseString(parser.SpacedNumber(), "\t-2.5e1 ")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, -25.0, result2)
+
+	p := parser.ManySepBy(parser.SpacedNumber(), parser.Char(','))
+	result3, err3 := parser.ParseString(p, " 1 , 2.5,3 ")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, []interface{}{1, 2.5, 3}, result3)
+
+	result4, err4 := parser.ParseString(parser.SpacedNumber(), " 99999999999999999999 ")
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Equal(t, 1e20, result4, "Expected a float64 for an integer too large for an int")
+
+	expectFails(t, parser.SpacedNumber(), "  x")
+	expectFails(t, parser.SpacedNumber(), " 1e999 ")
+}
+
+// miniJSON parses objects of strings and numbers, returning
+// map[string]interface{} for objects.
+func miniJSON() parser.Parser {
+	var value parser.Parser
+	value = parser.Lazy(func() parser.Parser {
+		str := parser.Sequence(parser.Char('"'), parser.Many(parser.NoneOf('"')), parser.Char('"'))
+		member := parser.PairOf(
+			parser.Surround(parser.Whitespace(), str, parser.Whitespace()),
+			parser.Char(':'),
+			parser.Surround(parser.Whitespace(), value, parser.Whitespace()))
+		object := parser.ParseWith(
+			parser.Surround(parser.Char('{'), parser.ManySepBy(member, parser.Char(',')), parser.Char('}')),
+			func(members interface{}) interface{} {
+				object := map[string]interface{}{}
+				for _, m := range members.([]interface{}) {
+					object[m.(parser.Pair).Key.(string)] = m.(parser.Pair).Value
+				}
+				return object
+			})
+		return parser.Or(object, str, parser.Digits())
+	})
+	return value
+}
+
+func renderJSON(value interface{}) string {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return value.(string)
+	}
+	keys := []string{}
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	members := []string{}
+	for _, key := range keys {
+		members = append(members, key+":"+renderJSON(object[key]))
+	}
+	return "{" + strings.Join(members, ",") + "}"
+}
+
+func TestCanonical(t *testing.T) {
+	p := parser.Canonical(miniJSON(), renderJSON)
+
+	result, err := parser.ParseString(p, `{ "b" : 2,"a":{"z": "x" ,  "y":1} }`)
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, `{"a":{"y":1,"z":"x"},"b":2}`, result)
+}
+
+func TestBaseDigits(t *testing.T) {
+	expectParses(t, parser.HexDigit(), "F")
+	expectParses(t, parser.OctDigit(), "7")
+	expectParses(t, parser.BinDigit(), "1")
+	expectFails(t, parser.HexDigit(), "g")
+	expectFails(t, parser.OctDigit(), "8")
+	expectFails(t, parser.BinDigit(), "2")
+}
+
+func TestBaseNumbers(t *testing.T) {
+	result1, err1 := parser.ParseString(parser.HexNumber(), "ff")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, int64(255), result1)
+
+	result2, err2 := parser.ParseString(parser.OctNumber(), "0755")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, int64(493), result2)
+
+	result3, err3 := parser.ParseString(parser.BinNumber(), "1010")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, int64(10), result3)
+
+	_, err4 := parser.ParseString(parser.HexNumber(), "ffffffffffffffffff")
+	assert.EqualError(t, err4, "invalid base 16 number 'ffffffffffffffffff' at line 0, col 18")
+}
+
+func TestFlexibleList(t *testing.T) {
+	p := parser.FlexibleList(parser.Many1(parser.Letter()))
+	expected := []interface{}{"a", "bc", "d"}
+	inputs := []string{
+		"a, bc, d",
+		"a\nbc\nd\n",
+		"a,\n  bc\n\n,d,",
+		"\n a ,, bc\t,\nd",
+	}
+	for _, input := range inputs {
+		result, err := parser.ParseStringComplete(p, input)
+		assert.NoError(t, err, "Expected successful parse of %q", input)
+		assert.Equal(t, expected, result)
+	}
+
+	result, err := parser.ParseString(parser.FlexibleList(parser.Digit()), "")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []interface{}{}, result)
+}
+
+func TestIdentifier(t *testing.T) {
+	p := parser.Sequence(parser.Identifier(), parser.EOF())
+	expectParses(t, p, "foo")
+	expectParses(t, p, "_bar1")
+	expectParses(t, p, "x")
+	expectFails(t, p, "1abc")
+	expectFails(t, p, "")
+	expectFails(t, p, "a-b")
+}
+
+func TestIdentifierWith(t *testing.T) {
+	kebab := parser.IdentifierWith(parser.LowerLetter(), parser.Or(parser.LowerLetter(), parser.Char('-')))
+	result, err := parser.ParseString(kebab, "max-width: 3")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "max-width", result)
+
+	expectFails(t, kebab, "-max")
+}
+
+func TestQuotedString(t *testing.T) {
+	p := parser.QuotedString('"', '\\')
+
+	result, err := parser.ParseString(p, `"a\"b" rest`)
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, `a\"b`, result)
+
+	result2, err2 := parser.ParseString(p, `""`)
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "", result2)
+
+	result3, err3 := parser.ParseString(parser.QuotedString('\'', '`'), "'it``s `'ok`''")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, "it``s `'ok`'", result3)
+
+	_, err4 := parser.ParseString(p, `"abc`)
+	assert.EqualError(t, err4, "expected a character, got error Reached end of input at line 0, col 4")
+	expectFails(t, p, `"abc\"`)
+	expectFails(t, p, `abc"`)
+}
+
+func TestVerbatim(t *testing.T) {
+	code := parser.Verbatim(parser.Char('`'), parser.Char('`'))
+	word := parser.Many1(parser.Letter())
+	p := parser.ListOf(parser.Surround(parser.Whitespace(), parser.Or(code, word), parser.Whitespace()))
+
+	result, err := parser.ParseStringComplete(p, "  run \t`go  test\t./...`  now ")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []interface{}{"run", "go  test\t./...", "now"}, result)
+
+	fenced := parser.Verbatim(parser.Token("<<"), parser.Token(">>"))
+	result2, err2 := parser.ParseString(fenced, "<< a > b >>")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, " a > b ", result2)
+
+	expectFails(t, code, "`unterminated")
+}
+
+func TestLine(t *testing.T) {
+	p := parser.Map([]parser.Named{
+		{"first", parser.Line()},
+		{"", parser.Char('\n')},
+		{"second", parser.Line()},
+	}, func(m map[string]interface{}) interface{} {
+		return []interface{}{m["first"], m["second"]}
+	})
+
+	result, err := parser.ParseStringComplete(p, "hello\nworld")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []interface{}{"hello", "world"}, result)
+
+	expectFails(t, parser.Sequence(parser.Line(), parser.EOF()), "hello\nworld")
+}
+
+func TestInteger(t *testing.T) {
+	result1, err1 := parser.ParseString(parser.Integer(), "0")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, 0, result1)
+
+	result2, err2 := parser.ParseString(parser.Integer(), "42")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, 42, result2)
+
+	_, err3 := parser.ParseString(parser.Integer(), "99999999999999999999")
+	assert.EqualError(t, err3, "invalid integer '99999999999999999999' at line 0, col 20")
+
+	expectFails(t, parser.Integer(), "-7")
+}
+
+func TestSignedInteger(t *testing.T) {
+	result1, err1 := parser.ParseString(parser.SignedInteger(), "-7")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, -7, result1)
+
+	result2, err2 := parser.ParseString(parser.SignedInteger(), "+9")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, 9, result2)
+
+	result3, err3 := parser.ParseString(parser.SignedInteger(), "42")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, 42, result3)
+
+	expectFails(t, parser.SignedInteger(), "-99999999999999999999")
+	expectFails(t, parser.SignedInteger(), "-")
+}
+
+func TestIntInRange(t *testing.T) {
+	port := parser.IntInRange(1, 65535)
+
+	result1, err1 := parser.ParseString(port, "1")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, int64(1), result1)
+
+	result2, err2 := parser.ParseString(port, "65535")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, int64(65535), result2)
+
+	_, err3 := parser.ParseString(port, "0")
+	assert.EqualError(t, err3, "value 0 out of range [1, 65535] at line 0, col 1")
+
+	_, err4 := parser.ParseString(port, "65536")
+	assert.EqualError(t, err4, "value 65536 out of range [1, 65535] at line 0, col 5")
+
+	_, err5 := parser.ParseString(port, "99999999999999999999")
+	assert.Error(t, err5, "Expected an error for a value too large for an int64")
+
+	result6, err6 := parser.ParseString(parser.IntInRange(-10, 10), "-10")
+	assert.NoError(t, err6, "Expected successful parse")
+	assert.Equal(t, int64(-10), result6)
+
+	expectFails(t, port, "x")
+}
+
+func TestGroupedInteger(t *testing.T) {
+	p := parser.GroupedInteger(',')
+	inputs := map[string]int64{
+		"1,234,567": 1234567,
+		"12,345":    12345,
+		"999":       999,
+		"1234567":   1234567,
+		"0":         0,
+	}
+	for input, expected := range inputs {
+		result, err := parser.ParseStringComplete(p, input)
+		assert.NoError(t, err, "Expected successful parse of "+input)
+		assert.Equal(t, expected, result)
+	}
+
+	_, err := parser.ParseString(p, "1,23,456")
+	assert.EqualError(t, err, "digit group '23' has the wrong size at line 0, col 8")
+	expectFails(t, p, "1234,567")
+	expectFails(t, p, "1,2345")
+
+	result, err2 := parser.ParseString(parser.GroupedInteger('.'), "1.000.000")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, int64(1000000), result)
+}
+
+func TestFloat(t *testing.T) {
+	inputs := map[string]float64{
+		"3.14":   3.14,
+		"-0.5":   -0.5,
+		"1e10":   1e10,
+		"2.5E-3": 2.5e-3,
+		"7":      7,
+	}
+	for input, expected := range inputs {
+		result, err := parser.ParseString(parser.Float(), input)
+		assert.NoError(t, err, "Expected successful parse of "+input)
+		assert.Equal(t, expected, result)
+	}
+
+	expectFails(t, parser.Float(), ".")
+	expectFails(t, parser.Float(), "-")
+
+	_, err := parser.ParseString(parser.Float(), "1e999")
+	assert.EqualError(t, err, "invalid number '1e999' at line 0, col 5")
+}
+
+func TestRunLength(t *testing.T) {
+	p := parser.RunLength('#')
+
+	result1, err1 := parser.ParseString(p, "# Title")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, 1, result1)
+
+	result2, err2 := parser.ParseString(p, "### Section")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, 3, result2)
+
+	result3, err3 := parser.ParseString(parser.RunLength('☃'), "☃☃x")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, 2, result3)
+
+	expectFails(t, p, "Title #")
+}
+
+func TestWhitespaceChar(t *testing.T) {
+	expectParses(t, parser.WhitespaceChar(), " ")
+	expectParses(t, parser.WhitespaceChar(), "\t")
+	expectFails(t, parser.WhitespaceChar(), "\b")
+}
+
+func TestUnicodeWhitespace(t *testing.T) {
+	expectParses(t, parser.UnicodeWhitespaceChar(), "\u00a0") // non-breaking space
+	expectParses(t, parser.UnicodeWhitespaceChar(), "\u2003") // em space
+	expectFails(t, parser.UnicodeWhitespaceChar(), "\b")
+	expectFails(t, parser.UnicodeWhitespaceChar(), "x")
+
+	result, err := parser.ParseString(parser.UnicodeWhitespace(), "\u00a0\u2003 \tx")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "\u00a0\u2003 \t", result)
+}
+
+func TestBracketedList(t *testing.T) {
+	p := parser.BracketedList('[', ']', parser.Digits())
+
+	result1, err1 := parser.ParseString(p, "[ ]")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []interface{}{}, result1)
+
+	result2, err2 := parser.ParseString(p, "[1]")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{"1"}, result2)
+
+	result3, err3 := parser.ParseString(p, "[ 1, 22 ,333 ]")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, []interface{}{"1", "22", "333"}, result3)
+
+	result4, err4 := parser.ParseString(p, "[1, 2,\n]")
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Equal(t, []interface{}{"1", "2"}, result4)
+
+	expectFails(t, p, "[,]")
+	expectFails(t, p, "[1,,]")
+	expectFails(t, p, "[1")
+}
+
+func TestChainLeft1(t *testing.T) {
+	number := parser.ParseWith(parser.Digits(), func(digits interface{}) interface{} {
+		n, _ := strconv.Atoi(digits.(string))
+		return n
+	})
+	minus := parser.ParseAs(parser.Char('-'), func(left, right interface{}) interface{} {
+		return left.(int) - right.(int)
+	})
+	p := parser.ChainLeft1(number, minus)
+
+	result1, err1 := parser.ParseString(p, "10-2-3")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, 5, result1, "Expected (10-2)-3, not 10-(2-3)")
+
+	result2, err2 := parser.ParseString(p, "7")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, 7, result2)
+
+	tree := parser.ChainLeft1(parser.Digits(), parser.ParseAs(parser.Char('-'), func(left, right interface{}) interface{} {
+		return access{left, right}
+	}))
+	result3, err3 := parser.ParseString(tree, "1-2-3")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, access{access{"1", "2"}, "3"}, result3)
+
+	expectFails(t, p, "-1")
+}
+
+func TestChainRight1(t *testing.T) {
+	power := parser.ParseAs(parser.Char('^'), func(left, right interface{}) interface{} {
+		return access{left, right}
+	})
+	p := parser.ChainRight1(parser.Digits(), power)
+
+	result1, err1 := parser.ParseString(p, "2^3^4")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, access{"2", access{"3", "4"}}, result1)
+
+	result2, err2 := parser.ParseString(p, "2^3")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, access{"2", "3"}, result2)
+
+	result3, err3 := parser.ParseString(p, "7")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, "7", result3)
+}
+
+func TestGroupedExpression(t *testing.T) {
+	spaced := func(p parser.Parser) parser.Parser {
+		return parser.Surround(parser.Whitespace(), p, parser.Whitespace())
+	}
+	arithmetic := func(op, left, right interface{}) interface{} {
+		switch op {
+		case "*":
+			return left.(int) * right.(int)
+		case "/":
+			return left.(int) / right.(int)
+		case "+":
+			return left.(int) + right.(int)
+		default:
+			return left.(int) - right.(int)
+		}
+	}
+	p := parser.GroupedExpression(
+		spaced(parser.SpacedNumber()),
+		spaced(parser.Char('(')),
+		spaced(parser.Char(')')),
+		[]parser.OperatorLevel{
+			{Operator: parser.AnyChar('*', '/'), Combine: arithmetic},
+			{Operator: parser.AnyChar('+', '-'), Combine: arithmetic},
+		})
+
+	result1, err1 := parser.ParseString(p, "2 * (3 + 4)")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, 14, result1)
+
+	result2, err2 := parser.ParseString(p, "2 * 3 + 4")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, 10, result2)
+
+	result3, err3 := parser.ParseString(p, "((1 - 2) - 3) * 2")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, -8, result3)
+
+	result4, err4 := parser.ParseString(p, "10 - (2 - 3) - 1")
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Equal(t, 10, result4)
+
+	expectFails(t, p, "(1 + 2")
+}
+
+func TestDetectBOM(t *testing.T) {
+	p := parser.Map([]parser.Named{
+		{"encoding", parser.DetectBOM()},
+		{"text", parser.Token("hi")},
+	}, func(m map[string]interface{}) interface{} {
+		return m["encoding"].(string) + " " + m["text"].(string)
+	})
+
+	inputs := map[string]string{
+		"\ufeffhi":               "UTF-8 hi",
+		"\u00ef\u00bb\u00bfhi":   "UTF-8 hi",
+		"\u00fe\u00ffhi":         "UTF-16BE hi",
+		"\u00ff\u00fehi":         "UTF-16LE hi",
+		"\x00\x00\u00fe\u00ffhi": "UTF-32BE hi",
+		"\u00ff\u00fe\x00\x00hi": "UTF-32LE hi",
+		"hi":                     "none hi",
+	}
+	for input, expected := range inputs {
+		result, err := parser.ParseString(p, input)
+		assert.NoError(t, err, "Expected successful parse of %q", input)
+		assert.Equal(t, expected, result)
+	}
+}
+
+func TestKeywordOrIdentifier(t *testing.T) {
+	p := parser.KeywordOrIdentifier(map[string]struct{}{"if": {}, "else": {}})
+
+	result1, err1 := parser.ParseString(p, "if(x)")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, parser.IdentifierToken{IsKeyword: true, Text: "if"}, result1)
+
+	result2, err2 := parser.ParseString(p, "ifx")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, parser.IdentifierToken{IsKeyword: false, Text: "ifx"}, result2)
+
+	result3, err3 := parser.ParseString(p, "_count2 = 1")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, parser.IdentifierToken{IsKeyword: false, Text: "_count2"}, result3)
+
+	expectFails(t, p, "2x")
+}
+
+func TestLogLine(t *testing.T) {
+	space := parser.Whitespace1()
+	p := parser.LogLine([]parser.LogField{
+		{Name: "month", Parser: parser.Many1(parser.Letter()), Separator: space},
+		{Name: "day", Parser: parser.Digits(), Separator: space},
+		{Name: "time", Parser: parser.Many1(parser.AnyCharIn("0123456789:")), Separator: space},
+		{Name: "host", Parser: parser.Many1(parser.AlphaNum()), Separator: space},
+		{Name: "process", Parser: parser.Many1(parser.NoneOf(':')), Separator: parser.Token(": ")},
+		{Name: "message", Parser: parser.Many(parser.NoneOf('\n'))},
+	})
+
+	result, err := parser.ParseString(p, "Oct 16 09:24:37 web1 sshd[42]: Accepted key")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, map[string]interface{}{
+		"month":   "Oct",
+		"day":     "16",
+		"time":    "09:24:37",
+		"host":    "web1",
+		"process": "sshd[42]",
+		"message": "Accepted key",
+	}, result)
+
+	_, err2 := parser.ParseString(p, "Oct 16  web1 sshd: hi")
+	assert.EqualError(t, err2, "expected time at line 0, col 9")
+}
+
+func TestAnnotated(t *testing.T) {
+	args := parser.Sequence(parser.Char('('), parser.TakeUntil(func(r rune) bool { return r == ')' }), parser.Char(')'))
+	annotation := parser.Sequence(parser.Char('@'), parser.Identifier(), parser.Maybe(args))
+	p := parser.Annotated(parser.Identifier(), annotation)
+
+	result1, err1 := parser.ParseStringComplete(p, "value")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, parser.AnnotatedValue{Value: "value", Annotations: []interface{}{}}, result1)
+
+	result2, err2 := parser.ParseStringComplete(p, "value @deprecated")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, parser.AnnotatedValue{Value: "value", Annotations: []interface{}{"@deprecated"}}, result2)
+
+	result3, err3 := parser.ParseStringComplete(p, "value @deprecated  @since(1.2)")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, parser.AnnotatedValue{
+		Value:       "value",
+		Annotations: []interface{}{"@deprecated", "@since(1.2)"},
+	}, result3)
+
+	// Trailing whitespace without an annotation is left unconsumed
+	_, err4 := parser.ParseStringComplete(p, "value @deprecated ")
+	assert.Error(t, err4, "Expected an error")
+}
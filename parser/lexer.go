@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/jmikkola/parsego/parser/result"
+	"github.com/jmikkola/parsego/parser/scanner"
+	"github.com/jmikkola/parsego/parser/textpos"
+)
+
+// LexRule pairs a parser with the type of token it produces.
+type LexRule struct {
+	Type   string
+	Parser Parser
+	Skip   bool // drop the matched text instead of producing a token
+}
+
+// LexedToken is a single token produced by Lexer.
+type LexedToken struct {
+	Type  string
+	Text  string
+	Range textpos.TextRange
+}
+
+// LexerParser splits the input into tokens.
+type LexerParser struct {
+	rules []LexRule
+}
+
+// Lexer returns a parser that repeatedly applies the first of the
+// rules that matches, producing a []LexedToken. It stops when no rule
+// matches (or a rule matches without consuming any input). The text of
+// each token is the text its rule matched, regardless of the parser's
+// result.
+func Lexer(rules []LexRule) Parser {
+	return &LexerParser{rules}
+}
+
+// Parse parses the input.
+func (p *LexerParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	tokens := []LexedToken{}
+
+	for p.lexOne(sc, &tokens) {
+	}
+
+	return result.Success(textpos.Range(start, sc.GetPos()), tokens)
+}
+
+// lexOne applies the first matching rule, returning false if none
+// matched.
+func (p *LexerParser) lexOne(sc scanner.Scanner, tokens *[]LexedToken) bool {
+	for _, rule := range p.rules {
+		before := sc.GetPos()
+		sc.StartSnapshot()
+		r, text := parseRecorded(rule.Parser, sc)
+		if !r.Matched() || sc.GetPos() == before {
+			sc.RewindSnapshot()
+			continue
+		}
+		sc.PopSnapshot()
+
+		if !rule.Skip {
+			*tokens = append(*tokens, LexedToken{
+				Type:  rule.Type,
+				Text:  string(text),
+				Range: textpos.Range(before, sc.GetPos()),
+			})
+		}
+		return true
+	}
+	return false
+}
+
+// TokenScanner is a Scanner over a list of tokens (usually produced by
+// Lexer) instead of runes, for parsing in two phases. Use MatchToken to
+// parse tokens from it.
+type TokenScanner struct {
+	tokens []LexedToken
+	idx    int
+	marks  []int
+}
+
+// NewTokenScanner creates a TokenScanner over the given tokens.
+func NewTokenScanner(tokens []LexedToken) *TokenScanner {
+	return &TokenScanner{tokens: tokens}
+}
+
+// ParseTokens parses a list of tokens, using a new Session.
+func ParseTokens(parser Parser, tokens []LexedToken) (interface{}, error) {
+	return newSession(NewTokenScanner(tokens)).Parse(parser)
+}
+
+// Next reads the next token, or returns an EOFError if there are none
+// left.
+func (s *TokenScanner) Next() (LexedToken, error) {
+	if s.idx >= len(s.tokens) {
+		return LexedToken{}, &scanner.EOFError{}
+	}
+	t := s.tokens[s.idx]
+	s.idx++
+	return t, nil
+}
+
+// Read returns an EOFError if there are no tokens left, so that EOF
+// works on tokens too. Otherwise it fails without consuming anything,
+// since a token stream can't be read one rune at a time; use
+// MatchToken to read tokens.
+func (s *TokenScanner) Read() (rune, error) {
+	if s.idx >= len(s.tokens) {
+		return 0, &scanner.EOFError{}
+	}
+	return 0, fmt.Errorf("can't read a character from a %s token; use MatchToken", s.tokens[s.idx].Type)
+}
+
+// GetPos returns the position where the next token starts, or where
+// the last token ended if there are none left.
+func (s *TokenScanner) GetPos() textpos.TextPos {
+	if s.idx < len(s.tokens) {
+		return s.tokens[s.idx].Range.Start()
+	}
+	if len(s.tokens) > 0 {
+		return s.tokens[len(s.tokens)-1].Range.End()
+	}
+	return textpos.StartingPos()
+}
+
+// Offset returns the number of tokens read so far.
+func (s *TokenScanner) Offset() int {
+	return s.idx
+}
+
+// Seek moves the scanner to the given offset, counted in tokens.
+// Offsets past the end of the tokens move to the end.
+func (s *TokenScanner) Seek(offset int) {
+	if offset > len(s.tokens) {
+		offset = len(s.tokens)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	s.idx = offset
+}
+
+// StartSnapshot takes a new snapshot that can be rolled back to
+// later.
+func (s *TokenScanner) StartSnapshot() {
+	s.marks = append(s.marks, s.idx)
+}
+
+// RewindSnapshot reverts the scanner back to the last snapshot.
+func (s *TokenScanner) RewindSnapshot() {
+	if len(s.marks) == 0 {
+		panic("Bug: rewinding to a snapshot that was never started")
+	}
+	last := len(s.marks) - 1
+	s.idx = s.marks[last]
+	s.marks = s.marks[:last]
+}
+
+// PopSnapshot drops a snapshot when it is no longer needed.
+func (s *TokenScanner) PopSnapshot() {
+	if len(s.marks) == 0 {
+		panic("Bug: popped a snapshot that was never started")
+	}
+	s.marks = s.marks[:len(s.marks)-1]
+}
+
+// TokenTypeParser matches a single token of some type.
+type TokenTypeParser struct {
+	typ string
+}
+
+// MatchToken returns a parser that matches a single token of the given
+// type from a TokenScanner, returning the LexedToken.
+func MatchToken(typ string) Parser {
+	return &TokenTypeParser{typ}
+}
+
+// Parse parses the input.
+func (p *TokenTypeParser) Parse(sc scanner.Scanner) result.ParseResult {
+	ts, ok := findScanner(sc, func(s scanner.Scanner) bool {
+		_, ok := s.(*TokenScanner)
+		return ok
+	}).(*TokenScanner)
+	if !ok {
+		return fail(sc.GetPos(), "expected a %s token, but the input is not tokens", p.typ)
+	}
+
+	start := ts.GetPos()
+	t, err := ts.Next()
+	if err != nil {
+		return fail(start, "expected a %s token, got error %v", p.typ, err)
+	}
+	if t.Type != p.typ {
+		return fail(start, "expected a %s token, got %s %q", p.typ, t.Type, t.Text)
+	}
+	return result.Success(t.Range, t)
+}
@@ -0,0 +1,130 @@
+package parser_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmikkola/parsego/parser"
+	"github.com/jmikkola/parsego/parser/textpos"
+)
+
+func arithmeticRules() []parser.LexRule {
+	return []parser.LexRule{
+		{Type: "space", Parser: parser.Whitespace1(), Skip: true},
+		{Type: "number", Parser: parser.Digits()},
+		{Type: "name", Parser: parser.Many1(parser.Letter())},
+		{Type: "op", Parser: parser.AnyChar('+', '-', '*', '/')},
+		{Type: "paren", Parser: parser.AnyChar('(', ')')},
+	}
+}
+
+func TestLexer(t *testing.T) {
+	p := parser.Lexer(arithmeticRules())
+
+	result, err := parser.ParseString(p, "12 * (x+3)")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []parser.LexedToken{
+		{"number", "12", textpos.Range(textpos.Pos(0, 0), textpos.Pos(0, 2))},
+		{"op", "*", textpos.Range(textpos.Pos(0, 3), textpos.Pos(0, 4))},
+		{"paren", "(", textpos.Range(textpos.Pos(0, 5), textpos.Pos(0, 6))},
+		{"name", "x", textpos.Range(textpos.Pos(0, 6), textpos.Pos(0, 7))},
+		{"op", "+", textpos.Range(textpos.Pos(0, 7), textpos.Pos(0, 8))},
+		{"number", "3", textpos.Range(textpos.Pos(0, 8), textpos.Pos(0, 9))},
+		{"paren", ")", textpos.Range(textpos.Pos(0, 9), textpos.Pos(0, 10))},
+	}, result)
+
+	_, err2 := parser.ParseString(parser.Sequence(p, parser.EOF()), "1 % 2")
+	assert.Error(t, err2, "Expected error when no rule matches")
+}
+
+func tok(typ, text string, col int) parser.LexedToken {
+	return parser.LexedToken{
+		Type:  typ,
+		Text:  text,
+		Range: textpos.Range(textpos.Pos(0, col), textpos.Pos(0, col+len(text))),
+	}
+}
+
+func TestMatchToken(t *testing.T) {
+	text := func(v interface{}) interface{} {
+		return v.(parser.LexedToken).Text
+	}
+	name := parser.ParseWith(parser.MatchToken("name"), text)
+	number := parser.ParseWith(parser.MatchToken("number"), text)
+	// Both alternatives start with a name, so the first must backtrack
+	// when there is no "(" after it.
+	call := parser.Map([]parser.Named{
+		{"fn", name},
+		{"", parser.MatchToken("open")},
+		{"arg", parser.Or(number, name)},
+		{"", parser.MatchToken("close")},
+	}, func(m map[string]interface{}) interface{} {
+		return m["fn"].(string) + "/" + m["arg"].(string)
+	})
+	p := parser.Sequence(parser.Or(call, name, number), parser.EOF())
+
+	result1, err1 := parser.ParseTokens(p, []parser.LexedToken{
+		tok("name", "f", 0), tok("open", "(", 1), tok("number", "12", 2), tok("close", ")", 4),
+	})
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "f/12", result1)
+
+	result2, err2 := parser.ParseTokens(p, []parser.LexedToken{tok("name", "f", 0)})
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "f", result2)
+
+	_, err3 := parser.ParseTokens(p, []parser.LexedToken{
+		tok("name", "f", 0), tok("open", "(", 1), tok("close", ")", 2),
+	})
+	assert.Error(t, err3, "Expected an error for the missing argument")
+
+	_, err4 := parser.ParseString(parser.MatchToken("name"), "f")
+	assert.Error(t, err4, "Expected an error when the input isn't tokens")
+}
+
+func TestLexThenParse(t *testing.T) {
+	tokens, err := parser.ParseString(parser.Lexer(arithmeticRules()), "1 + 22")
+	assert.NoError(t, err, "Expected successful lex")
+
+	sum := parser.Map([]parser.Named{
+		{"left", parser.MatchToken("number")},
+		{"", parser.MatchToken("op")},
+		{"right", parser.MatchToken("number")},
+	}, func(m map[string]interface{}) interface{} {
+		return m["left"].(parser.LexedToken).Text + "," + m["right"].(parser.LexedToken).Text
+	})
+	result, err := parser.ParseTokens(sum, tokens.([]parser.LexedToken))
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "1,22", result)
+}
+
+func TestTokenScannerRead(t *testing.T) {
+	tokens := []parser.LexedToken{tok("number", "12", 0), tok("op", "+", 2)}
+
+	_, err := parser.ParseTokens(parser.Char('1'), tokens)
+	assert.EqualError(t, err,
+		"expected a character, got error can't read a character from a number token; use MatchToken at line 0, col 0")
+
+	_, err2 := parser.ParseTokens(parser.Sequence(parser.MatchToken("number"), parser.EOF()), tokens)
+	assert.Error(t, err2, "Expected EOF to fail with tokens left")
+
+	ts := parser.NewTokenScanner(tokens)
+	_, err3 := ts.Read()
+	assert.Error(t, err3, "Expected rune reads to be refused")
+	next, err4 := ts.Next()
+	assert.NoError(t, err4, "Expected the refused read not to consume a token")
+	assert.Equal(t, "12", next.Text)
+}
+
+func TestRuleOverTokens(t *testing.T) {
+	num := parser.Rule("num", parser.MatchToken("number"))
+	op := parser.MatchToken("op")
+	p := parser.Or(
+		parser.Sequence(num, op, num, parser.MatchToken("close")),
+		parser.Sequence(num, op, num, parser.EOF()))
+
+	tokens := []parser.LexedToken{tok("number", "1", 0), tok("op", "+", 2), tok("number", "2", 4)}
+	_, err := parser.ParseTokens(p, tokens)
+	assert.NoError(t, err, "Expected the memoized rule to move past its token")
+}
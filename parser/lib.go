@@ -21,13 +21,13 @@ import (
 	"io"
 	"io/ioutil"
 
+	"github.com/jmikkola/parsego/parser/result"
 	"github.com/jmikkola/parsego/parser/scanner"
 )
 
-// ParseString parses the text in a string.
+// ParseString parses the text in a string, using a new Session.
 func ParseString(parser Parser, str string) (interface{}, error) {
-	result := parser.Parse(scanner.FromString(str))
-	return result.Result(), result.Error()
+	return NewSession(str).Parse(parser)
 }
 
 // ParseScanner parses the text from a scanner.
@@ -40,3 +40,30 @@ func ParseScanner(parser Parser, reader io.Reader) (interface{}, error) {
 	}
 	return ParseString(parser, string(bytes))
 }
+
+// ParseStringComplete works like ParseString, but fails if the parser
+// doesn't consume the whole string. The error is reported at the first
+// character that wasn't consumed.
+func ParseStringComplete(parser Parser, str string) (interface{}, error) {
+	return ParseString(&completeParser{parser}, str)
+}
+
+// ParseScannerComplete works like ParseScanner, but fails if the
+// parser doesn't consume all of the text.
+func ParseScannerComplete(parser Parser, reader io.Reader) (interface{}, error) {
+	return ParseScanner(&completeParser{parser}, reader)
+}
+
+// completeParser requires the inner parser to consume all the input.
+type completeParser struct {
+	inner Parser
+}
+
+// Parse parses the input.
+func (p *completeParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r := p.inner.Parse(sc)
+	if r.Matched() && !atEOF(sc) {
+		return fail(sc.GetPos(), "unexpected input after the end")
+	}
+	return r
+}
@@ -2,7 +2,15 @@ package parser
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/jmikkola/parsego/parser/result"
 	"github.com/jmikkola/parsego/parser/scanner"
@@ -32,6 +40,9 @@ func (p *EOFParser) Parse(sc scanner.Scanner) result.ParseResult {
 	if err == nil {
 		return fail(sc.GetPos(), "expected EOF, got %c", r)
 	}
+	if _, ok := err.(*scanner.EOFError); !ok {
+		return fail(sc.GetPos(), "expected EOF, got error %v", err)
+	}
 	return result.Success(textpos.Single(sc.GetPos()), "")
 }
 
@@ -59,7 +70,8 @@ func (p *CharRangeParser) Parse(sc scanner.Scanner) result.ParseResult {
 	if err != nil {
 		return fail(sc.GetPos(), "expected a character, got error %v", err)
 	}
-	if r < p.min || r > p.max {
+	inRange := func(r rune) bool { return r >= p.min && r <= p.max }
+	if !matchFold(sc, r, inRange) {
 		return fail(sc.GetPos(),
 			"expected a character in the range '%c' to '%c', got error %c",
 			p.min, p.max, r)
@@ -72,12 +84,29 @@ func (p *CharRangeParser) Parse(sc scanner.Scanner) result.ParseResult {
 // TokenParser works like a series of CharRangeParsers, but is more
 // efficient.
 type TokenParser struct {
-	token string
+	token      string
+	ignoreCase bool
 }
 
 // Token returns a parser that parses the exact string given.
 func Token(token string) Parser {
-	return &TokenParser{token}
+	return &TokenParser{token: token}
+}
+
+// TokenCI works like Token, but ignores case, so TokenCI("select")
+// matches "SELECT" and "Select". The result is the text as it appears
+// in the input.
+func TokenCI(token string) Parser {
+	return &TokenParser{token: token, ignoreCase: true}
+}
+
+// equalRune returns whether the runes match, ignoring case if the
+// parser or the scanner's session says to.
+func (p *TokenParser) equalRune(sc scanner.Scanner, r, c rune) bool {
+	if r == c || (p.ignoreCase && unicode.ToLower(r) == unicode.ToLower(c)) {
+		return true
+	}
+	return matchFold(sc, r, func(f rune) bool { return f == c })
 }
 
 // Parse parses the input.
@@ -90,7 +119,7 @@ func (p *TokenParser) Parse(sc scanner.Scanner) result.ParseResult {
 		if err != nil {
 			return fail(sc.GetPos(), "expected '%s', got error %v", p.token, err)
 		}
-		if r != c {
+		if !p.equalRune(sc, r, c) {
 			return fail(sc.GetPos(), "expected '%s', got '%s'", p.token, string(seen))
 		}
 	}
@@ -152,7 +181,11 @@ func (p *CharSetParser) Parse(sc scanner.Scanner) result.ParseResult {
 	if err != nil {
 		return fail(sc.GetPos(), "expected a character, got error %v", err)
 	}
-	if _, ok := p.allowed[r]; ok == p.invert {
+	inSet := func(r rune) bool {
+		_, ok := p.allowed[r]
+		return ok
+	}
+	if matchFold(sc, r, inSet) == p.invert {
 		return fail(sc.GetPos(), "expected a character in the set, got error %c", r)
 	}
 	return result.Success(textpos.Range(start, sc.GetPos()), string(r))
@@ -172,7 +205,7 @@ func Sequence(parsers ...Parser) Parser {
 // Parse parses the input.
 func (p *SeqParser) Parse(sc scanner.Scanner) result.ParseResult {
 	start := sc.GetPos()
-	var end textpos.TextPos
+	end := start
 	results := []interface{}{}
 
 	for _, inner := range p.parsers {
@@ -189,6 +222,106 @@ func (p *SeqParser) Parse(sc scanner.Scanner) result.ParseResult {
 	return result.Success(textpos.Range(start, end), cleanupResult(results))
 }
 
+// ConcatParser runs parsers in sequence and joins their string results.
+type ConcatParser struct {
+	sep     string
+	parsers []Parser
+}
+
+// ConcatWith works like Sequence, but joins adjacent string results with
+// sep instead of concatenating them. Non-string results are kept as
+// separate items, so if any are present the result is a list.
+func ConcatWith(sep string, parsers ...Parser) Parser {
+	return &ConcatParser{sep, parsers}
+}
+
+// Parse parses the input.
+func (p *ConcatParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	end := start
+	results := []interface{}{}
+
+	for _, inner := range p.parsers {
+		innerResult := inner.Parse(sc)
+		if !innerResult.Matched() {
+			return innerResult
+		}
+
+		end = innerResult.TextRange().End()
+		results = append(results, innerResult.Result())
+	}
+
+	return result.Success(textpos.Range(start, end), joinResults(results, p.sep))
+}
+
+// joinResults joins each run of adjacent strings in results with sep,
+// skipping empty strings. It returns a single string if there are no
+// other results.
+func joinResults(results []interface{}, sep string) interface{} {
+	joined := []interface{}{}
+	var run []string
+	flush := func() {
+		if len(run) > 0 {
+			joined = append(joined, strings.Join(run, sep))
+			run = nil
+		}
+	}
+
+	for _, r := range results {
+		if r == "" {
+			continue
+		}
+		if s, ok := r.(string); ok {
+			run = append(run, s)
+		} else {
+			flush()
+			joined = append(joined, r)
+		}
+	}
+	flush()
+
+	if len(joined) == 0 {
+		return ""
+	}
+	if len(joined) == 1 {
+		if s, ok := joined[0].(string); ok {
+			return s
+		}
+	}
+	return joined
+}
+
+// TimesParser runs a parser a fixed number of times.
+type TimesParser struct {
+	n     int
+	inner Parser
+}
+
+// Times returns a parser that runs the inner parser exactly n times in
+// series and combines the results like Sequence.
+func Times(n int, inner Parser) Parser {
+	return &TimesParser{n, inner}
+}
+
+// Parse parses the input.
+func (p *TimesParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	results := []interface{}{}
+
+	sc.StartSnapshot()
+	for i := 0; i < p.n; i++ {
+		innerResult := p.inner.Parse(sc)
+		if !innerResult.Matched() {
+			sc.RewindSnapshot()
+			return innerResult
+		}
+		results = append(results, innerResult.Result())
+	}
+	sc.PopSnapshot()
+
+	return result.Success(textpos.Range(start, sc.GetPos()), cleanupResult(results))
+}
+
 func cleanupResult(results []interface{}) interface{} {
 	var buffer bytes.Buffer
 	allStr := true
@@ -232,6 +365,33 @@ func (p *Wrapper) Parse(sc scanner.Scanner) result.ParseResult {
 	return innerResult
 }
 
+// ErrorWrapper modifies the result of a parser with a function that
+// can fail.
+type ErrorWrapper struct {
+	inner Parser
+	fn    func(interface{}) (interface{}, error)
+}
+
+// MapE works like ParseWith, except that if the function returns an
+// error, the parse fails with that error at the text the parser
+// matched.
+func MapE(p Parser, fn func(interface{}) (interface{}, error)) Parser {
+	return &ErrorWrapper{inner: p, fn: fn}
+}
+
+// Parse parses the input.
+func (p *ErrorWrapper) Parse(sc scanner.Scanner) result.ParseResult {
+	innerResult := p.inner.Parse(sc)
+	if !innerResult.Matched() {
+		return innerResult
+	}
+	value, err := p.fn(innerResult.Result())
+	if err != nil {
+		return result.Failed(innerResult.TextRange(), err)
+	}
+	return result.Success(innerResult.TextRange(), value)
+}
+
 // MaybeParser tries to run the inner parser, but allows the inner
 // parser to fail.
 type MaybeParser struct {
@@ -258,6 +418,56 @@ func (p *MaybeParser) Parse(sc scanner.Scanner) result.ParseResult {
 	return result.Success(textpos.Single(sc.GetPos()), "")
 }
 
+// NotParser succeeds only where the inner parser fails.
+type NotParser struct {
+	inner Parser
+}
+
+// Not returns a parser that matches (without consuming any input) only
+// if the inner parser doesn't match at the current position. Unlike
+// Maybe, it never advances the scanner.
+func Not(inner Parser) Parser {
+	return &NotParser{inner}
+}
+
+// Parse parses the input.
+func (p *NotParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	sc.StartSnapshot()
+	innerResult := p.inner.Parse(sc)
+	sc.RewindSnapshot()
+
+	if innerResult.Matched() {
+		return fail(start, "unexpected input")
+	}
+	return result.Success(textpos.Single(start), "")
+}
+
+// PeekParser looks ahead without consuming input.
+type PeekParser struct {
+	inner Parser
+}
+
+// Peek returns a parser that matches where the inner parser matches,
+// but without consuming any input. Like Not, its result is "", so it
+// adds nothing to the result of a Sequence.
+func Peek(inner Parser) Parser {
+	return &PeekParser{inner}
+}
+
+// Parse parses the input.
+func (p *PeekParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	sc.StartSnapshot()
+	innerResult := p.inner.Parse(sc)
+	sc.RewindSnapshot()
+
+	if !innerResult.Matched() {
+		return innerResult
+	}
+	return result.Success(textpos.Single(start), "")
+}
+
 // ManyParser Matches 0+ occurrences
 type ManyParser struct {
 	inner   Parser
@@ -282,10 +492,13 @@ func (p *ManyParser) Parse(sc scanner.Scanner) result.ParseResult {
 	results := []interface{}{}
 
 	for true {
+		before := sc.GetPos()
 		sc.StartSnapshot()
 		innerResult := p.inner.Parse(sc)
 
-		if innerResult.Matched() {
+		// Stop on a match that consumed nothing, since it would match
+		// again forever.
+		if innerResult.Matched() && sc.GetPos() != before {
 			sc.PopSnapshot()
 			results = append(results, innerResult.Result())
 		} else {
@@ -304,20 +517,78 @@ func (p *ManyParser) Parse(sc scanner.Scanner) result.ParseResult {
 	return result.Success(textpos.Range(start, sc.GetPos()), output)
 }
 
+// SkipManyParser matches 0+ (or 1+) occurrences, discarding the
+// results.
+type SkipManyParser struct {
+	inner Parser
+	min   int
+}
+
+// SkipMany works like Many, but doesn't collect the results, always
+// returning "". This avoids building strings that would be ignored
+// anyway, e.g. when skipping whitespace.
+func SkipMany(inner Parser) Parser {
+	return &SkipManyParser{inner: inner, min: 0}
+}
+
+// SkipMany1 works like SkipMany, but requires at least one match.
+func SkipMany1(inner Parser) Parser {
+	return &SkipManyParser{inner: inner, min: 1}
+}
+
+// Parse parses the input.
+func (p *SkipManyParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	for count := 0; ; count++ {
+		before := sc.GetPos()
+		sc.StartSnapshot()
+		innerResult := p.inner.Parse(sc)
+
+		// Stop on a match that consumed nothing, like Many
+		if innerResult.Matched() && sc.GetPos() != before {
+			sc.PopSnapshot()
+			continue
+		}
+		sc.RewindSnapshot()
+		if !innerResult.Matched() && count < p.min {
+			return innerResult
+		}
+		return result.Success(textpos.Range(start, sc.GetPos()), "")
+	}
+}
+
 // OrParser parses at most one of the inner parses.
 type OrParser struct {
 	parsers []Parser
+	limit   int // a negative limit means all parsers are tried
 }
 
 // Or returns a parser that accepts the union of the languages
-// accepted by the given parsers.
+// accepted by the given parsers. If none of them match, the error is
+// the one from the parser that got furthest into the input. If an
+// alternative fails with a committed failure (see Commit), the rest
+// aren't tried, and that failure is returned.
 func Or(parsers ...Parser) Parser {
-	return &OrParser{parsers}
+	return &OrParser{parsers: parsers, limit: -1}
+}
+
+// OrLimited works like Or, but gives up after trying the first max
+// alternatives. This bounds the work done when the alternatives are
+// ordered so that the likely ones come first. If none of them match,
+// the error from the furthest one notes that the limit was reached.
+func OrLimited(max int, parsers ...Parser) Parser {
+	return &OrParser{parsers: parsers, limit: max}
 }
 
 // Parse parses the input.
 func (p *OrParser) Parse(sc scanner.Scanner) result.ParseResult {
-	for _, inner := range p.parsers {
+	parsers := p.parsers
+	if p.limit >= 0 && p.limit < len(parsers) {
+		parsers = parsers[:p.limit]
+	}
+
+	var failure result.ParseResult
+	for _, inner := range parsers {
 		sc.StartSnapshot()
 		innerResult := inner.Parse(sc)
 
@@ -326,11 +597,74 @@ func (p *OrParser) Parse(sc scanner.Scanner) result.ParseResult {
 			return innerResult
 		}
 		sc.RewindSnapshot()
+		// The commitment only applies to this Or, so enclosing ones can
+		// still try their other alternatives
+		if committed, ok := innerResult.(*committedFailure); ok {
+			return committed.ParseResult
+		}
+		failure = furthest(failure, innerResult)
 	}
 
+	if len(parsers) < len(p.parsers) {
+		if failure == nil {
+			return fail(sc.GetPos(), "no parser matched in the first %d alternatives", p.limit)
+		}
+		return &limitedFailure{ParseResult: failure, limit: p.limit}
+	}
+	// Report the error from the alternative that got the furthest, since
+	// it is most likely the one that was meant
+	if failure != nil {
+		return failure
+	}
 	return fail(sc.GetPos(), "no parser matched")
 }
 
+// limitedFailure is the failure of an OrLimited that didn't try all
+// its alternatives.
+type limitedFailure struct {
+	result.ParseResult
+	limit int
+}
+
+// Error returns the error of the furthest alternative, noting the limit.
+func (r *limitedFailure) Error() error {
+	return fmt.Errorf("%v (no parser matched in the first %d alternatives)", r.ParseResult.Error(), r.limit)
+}
+
+// CommitParser marks the failure of a parser as committed.
+type CommitParser struct {
+	inner Parser
+}
+
+// Commit returns a parser that runs the inner parser, marking its
+// failure as committed, so that an enclosing Or returns it right away
+// instead of trying its other alternatives. Use it after the part of
+// an alternative that identifies it, e.g. Sequence(Token("if"),
+// Commit(condition)), so that an error in the condition is reported
+// rather than hidden by the other alternatives. Sequence and Map pass
+// the commitment on; parsers that replace the failure, like Label,
+// don't.
+func Commit(inner Parser) Parser {
+	return &CommitParser{inner}
+}
+
+// Parse parses the input.
+func (p *CommitParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r := p.inner.Parse(sc)
+	if r.Matched() {
+		return r
+	}
+	if _, ok := r.(*committedFailure); ok {
+		return r
+	}
+	return &committedFailure{r}
+}
+
+// committedFailure is a failure that Or shouldn't backtrack from.
+type committedFailure struct {
+	result.ParseResult
+}
+
 // Named is used for arguments to Map
 type Named struct {
 	Name   string
@@ -372,6 +706,28 @@ func (p *MapParser) Parse(sc scanner.Scanner) result.ParseResult {
 	return result.Success(textpos.Range(start, sc.GetPos()), p.fn(parsed))
 }
 
+// LabelParser replaces the error of the inner parser.
+type LabelParser struct {
+	name  string
+	inner Parser
+}
+
+// Label returns a parser that runs the inner parser, replacing the
+// error with "expected <name>" if it fails. The position of the error
+// is kept.
+func Label(name string, inner Parser) Parser {
+	return &LabelParser{name: name, inner: inner}
+}
+
+// Parse parses the input.
+func (p *LabelParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r := p.inner.Parse(sc)
+	if r.Matched() {
+		return r
+	}
+	return result.Failed(r.TextRange(), fmt.Errorf("expected %s", p.name))
+}
+
 // LazyFn contains a function that lazily constructs the real
 // parser. Useful for constructing recursive parsers.
 type LazyFn struct {
@@ -409,3 +765,2596 @@ func (p *IgnoreParser) Parse(sc scanner.Scanner) result.ParseResult {
 	}
 	return r
 }
+
+// EscapedFieldParser parses a field that ends at a delimiter, where
+// the delimiter can be escaped.
+type EscapedFieldParser struct {
+	delim  rune
+	escape rune
+}
+
+// EscapableField returns a parser that parses a field up to (but not
+// including) the delimiter or the end of the input. The escape rune
+// makes the rune after it part of the field, so `a\,b` is a single
+// field. The result is the unescaped field value.
+func EscapableField(delim, escape rune) Parser {
+	return &EscapedFieldParser{delim: delim, escape: escape}
+}
+
+// Parse parses the input.
+func (p *EscapedFieldParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	var buffer bytes.Buffer
+
+	for {
+		sc.StartSnapshot()
+		r, err := sc.Read()
+		if err != nil || r == p.delim {
+			sc.RewindSnapshot()
+			break
+		}
+		sc.PopSnapshot()
+
+		if r == p.escape {
+			r, err = sc.Read()
+			if err != nil {
+				return fail(sc.GetPos(), "expected a character after '%c', got error %v", p.escape, err)
+			}
+		}
+		buffer.WriteRune(r)
+	}
+
+	return result.Success(textpos.Range(start, sc.GetPos()), buffer.String())
+}
+
+// recordingScanner keeps a copy of the runes read through it, so that
+// parsers can find out the exact text an inner parser matched.
+type recordingScanner struct {
+	scanner.Scanner
+	runes []rune
+	marks []int
+}
+
+// Unwrap returns the underlying scanner.
+func (s *recordingScanner) Unwrap() scanner.Scanner {
+	return s.Scanner
+}
+
+// Read reads a rune from the underlying scanner and records it.
+func (s *recordingScanner) Read() (rune, error) {
+	r, err := s.Scanner.Read()
+	if err == nil {
+		s.runes = append(s.runes, r)
+	}
+	return r, err
+}
+
+// StartSnapshot takes a snapshot of both the underlying scanner and
+// the recorded text.
+func (s *recordingScanner) StartSnapshot() {
+	s.marks = append(s.marks, len(s.runes))
+	s.Scanner.StartSnapshot()
+}
+
+// RewindSnapshot rewinds the underlying scanner and forgets the text
+// read since the snapshot was taken.
+func (s *recordingScanner) RewindSnapshot() {
+	last := len(s.marks) - 1
+	s.runes = s.runes[:s.marks[last]]
+	s.marks = s.marks[:last]
+	s.Scanner.RewindSnapshot()
+}
+
+// PopSnapshot drops the last snapshot.
+func (s *recordingScanner) PopSnapshot() {
+	s.marks = s.marks[:len(s.marks)-1]
+	s.Scanner.PopSnapshot()
+}
+
+// parseRecorded runs the parser and also returns the text it consumed.
+func parseRecorded(p Parser, sc scanner.Scanner) (result.ParseResult, []rune) {
+	rec := &recordingScanner{Scanner: sc}
+	r := p.Parse(rec)
+	return r, rec.runes
+}
+
+// RunesParser returns the text matched by the inner parser as a slice
+// of runes.
+type RunesParser struct {
+	inner Parser
+}
+
+// RunesOf returns a parser that runs the inner parser, and returns the
+// text it matched as a []rune instead of a string.
+func RunesOf(inner Parser) Parser {
+	return &RunesParser{inner}
+}
+
+// Parse parses the input.
+func (p *RunesParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r, text := parseRecorded(p.inner, sc)
+	if r.Matched() {
+		return result.Success(r.TextRange(), text)
+	}
+	return r
+}
+
+// Comment is the result of NestedComment.
+type Comment struct {
+	Text  string // the raw text, including the delimiters
+	Depth int    // the deepest level of nesting seen, starting at 1
+}
+
+// NestedCommentParser parses a block comment that may contain nested
+// block comments.
+type NestedCommentParser struct {
+	open  Parser
+	close Parser
+}
+
+// NestedComment returns a parser that parses a block comment between
+// the open and close tokens, allowing nested comments like
+// `/* a /* b */ c */`. The result is a Comment.
+func NestedComment(open, close string) Parser {
+	return &NestedCommentParser{open: Token(open), close: Token(close)}
+}
+
+// tryParse runs the parser, rewinding the scanner if it fails.
+func tryParse(p Parser, sc scanner.Scanner) result.ParseResult {
+	sc.StartSnapshot()
+	r := p.Parse(sc)
+	if r.Matched() {
+		sc.PopSnapshot()
+	} else {
+		sc.RewindSnapshot()
+	}
+	return r
+}
+
+// Parse parses the input.
+func (p *NestedCommentParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	openResult := p.open.Parse(sc)
+	if !openResult.Matched() {
+		return openResult
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(openResult.Result().(string))
+	depth, maxDepth := 1, 1
+
+	for depth > 0 {
+		if r := tryParse(p.close, sc); r.Matched() {
+			buffer.WriteString(r.Result().(string))
+			depth--
+			continue
+		}
+		if r := tryParse(p.open, sc); r.Matched() {
+			buffer.WriteString(r.Result().(string))
+			depth++
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+			continue
+		}
+
+		r, err := sc.Read()
+		if err != nil {
+			return fail(sc.GetPos(), "unterminated comment, got error %v", err)
+		}
+		buffer.WriteRune(r)
+	}
+
+	return result.Success(
+		textpos.Range(start, sc.GetPos()),
+		Comment{Text: buffer.String(), Depth: maxDepth})
+}
+
+// ChecksumParser checks the text matched by a parser with a checksum
+// function.
+type ChecksumParser struct {
+	inner    Parser
+	checksum func(string) bool
+}
+
+// WithChecksum returns a parser that runs the body parser, then fails
+// if the checksum function rejects the text that the body matched.
+func WithChecksum(body Parser, checksum func(string) bool) Parser {
+	return &ChecksumParser{inner: body, checksum: checksum}
+}
+
+// Parse parses the input.
+func (p *ChecksumParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r, text := parseRecorded(p.inner, sc)
+	if r.Matched() && !p.checksum(string(text)) {
+		return result.Failed(r.TextRange(), fmt.Errorf("invalid checksum for '%s'", string(text)))
+	}
+	return r
+}
+
+// RoundTripParser checks that a parser's result renders back to the
+// text it was parsed from.
+type RoundTripParser struct {
+	inner  Parser
+	render func(interface{}) string
+}
+
+// RoundTrip returns a parser that runs the inner parser, then renders
+// the result with the render function, and fails if the rendered text
+// differs from the text that was parsed. This catches parsers (or
+// renderers) that lose information.
+func RoundTrip(inner Parser, render func(interface{}) string) Parser {
+	return &RoundTripParser{inner: inner, render: render}
+}
+
+// Parse parses the input.
+func (p *RoundTripParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r, text := parseRecorded(p.inner, sc)
+	if !r.Matched() {
+		return r
+	}
+	if rendered := p.render(r.Result()); rendered != string(text) {
+		return result.Failed(r.TextRange(), fmt.Errorf(
+			"round trip mismatch: parsed '%s' but rendered '%s'", string(text), rendered))
+	}
+	return r
+}
+
+// FieldAssigner parses lines of key-value pairs into the fields of a
+// struct.
+type FieldAssigner struct {
+	target reflect.Value
+	pair   Parser
+}
+
+// AssignFields returns a parser that parses newline separated `key =
+// value` lines, assigning each value to the field of the target struct
+// whose name matches the key (ignoring case). Values are converted from
+// strings to the type of the field. Unknown keys and values that can't
+// be converted cause the parse to fail. The target must be a pointer to
+// a struct, and is the result of a successful parse. It is only changed
+// once all the lines have parsed, so a failed parse leaves it as it was.
+func AssignFields(target interface{}, keyParser, separator, valueParser Parser) Parser {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		panic("parser: AssignFields needs a pointer to a struct")
+	}
+	pair := Map([]Named{
+		{"key", keyParser},
+		{"", separator},
+		{"value", valueParser},
+	}, func(m map[string]interface{}) interface{} {
+		return []interface{}{m["key"], m["value"]}
+	})
+	return &FieldAssigner{target: v, pair: pair}
+}
+
+// Parse parses the input.
+func (p *FieldAssigner) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	newline := Char('\n')
+	fields := reflect.New(p.target.Elem().Type()).Elem()
+	fields.Set(p.target.Elem())
+
+	for first := true; ; first = false {
+		sc.StartSnapshot()
+		if !first && !newline.Parse(sc).Matched() {
+			sc.RewindSnapshot()
+			break
+		}
+		r := p.pair.Parse(sc)
+		if !r.Matched() {
+			sc.RewindSnapshot()
+			break
+		}
+		sc.PopSnapshot()
+
+		kv := r.Result().([]interface{})
+		if err := assignField(fields, fmt.Sprint(kv[0]), fmt.Sprint(kv[1])); err != nil {
+			return result.Failed(r.TextRange(), err)
+		}
+	}
+
+	p.target.Elem().Set(fields)
+	return result.Success(textpos.Range(start, sc.GetPos()), p.target.Interface())
+}
+
+// assignField sets the field matching the given name to the value,
+// converted to the type of the field.
+func assignField(target reflect.Value, name, value string) error {
+	field := target.FieldByNameFunc(func(fieldName string) bool {
+		return strings.EqualFold(fieldName, name)
+	})
+	if !field.IsValid() || !field.CanSet() {
+		return fmt.Errorf("unknown key '%s'", name)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' for key '%s': %v", value, name, err)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' for key '%s': %v", value, name, err)
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' for key '%s': %v", value, name, err)
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' for key '%s': %v", value, name, err)
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %v for key '%s'", field.Type(), name)
+	}
+	return nil
+}
+
+// Arguments is the result of ArgumentList and ArgumentListWith.
+type Arguments struct {
+	Positional []interface{}
+	Keyword    map[string]interface{}
+}
+
+// keywordArg is a single `name=value` argument.
+type keywordArg struct {
+	name  string
+	value interface{}
+}
+
+// ArgumentListParser parses a function call style argument list.
+type ArgumentListParser struct {
+	open  Parser
+	close Parser
+	comma Parser
+	arg   Parser
+}
+
+// ArgumentList returns a parser that parses a parenthesized, comma
+// separated argument list like `(1, "a", x=2.5, y=z)`. Argument values
+// can be numbers (as float64), quoted strings (as with QuotedString)
+// or identifiers. Positional arguments must come before keyword
+// arguments, and keywords can't be repeated. The result is an
+// Arguments value.
+func ArgumentList() Parser {
+	return ArgumentListWith(Or(Float(), QuotedString('"', '\\'), Identifier()))
+}
+
+// ArgumentListWith works like ArgumentList, but uses the given parser
+// for the argument values.
+func ArgumentListWith(value Parser) Parser {
+	padded := func(c rune) Parser {
+		return Sequence(Whitespace(), Char(c), Whitespace())
+	}
+	name := Identifier()
+	keyword := Map([]Named{
+		{"name", name},
+		{"", padded('=')},
+		{"value", value},
+	}, func(m map[string]interface{}) interface{} {
+		return keywordArg{name: m["name"].(string), value: m["value"]}
+	})
+	return &ArgumentListParser{
+		open:  padded('('),
+		close: padded(')'),
+		comma: padded(','),
+		arg:   Or(keyword, value),
+	}
+}
+
+// Parse parses the input.
+func (p *ArgumentListParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	if r := p.open.Parse(sc); !r.Matched() {
+		return r
+	}
+
+	args := Arguments{
+		Positional: []interface{}{},
+		Keyword:    map[string]interface{}{},
+	}
+	for first := true; ; first = false {
+		if !first && !tryParse(p.comma, sc).Matched() {
+			break
+		}
+
+		r := tryParse(p.arg, sc)
+		if !r.Matched() {
+			if first {
+				break
+			}
+			return r
+		}
+
+		if kw, ok := r.Result().(keywordArg); ok {
+			if _, seen := args.Keyword[kw.name]; seen {
+				return result.Failed(r.TextRange(), fmt.Errorf("duplicate keyword argument '%s'", kw.name))
+			}
+			args.Keyword[kw.name] = kw.value
+		} else if len(args.Keyword) > 0 {
+			return result.Failed(r.TextRange(), fmt.Errorf("positional argument after keyword argument"))
+		} else {
+			args.Positional = append(args.Positional, r.Result())
+		}
+	}
+
+	if r := p.close.Parse(sc); !r.Matched() {
+		return r
+	}
+	return result.Success(textpos.Range(start, sc.GetPos()), args)
+}
+
+// SpannedValue is the result of Spanned.
+type SpannedValue struct {
+	Value interface{}
+	Span  textpos.TextRange
+}
+
+// SpanParser records the range of text matched by a parser.
+type SpanParser struct {
+	inner Parser
+}
+
+// Spanned returns a parser that runs the inner parser, and returns a
+// SpannedValue holding the inner result along with the range of text
+// it matched. This is useful for attaching source positions to AST
+// nodes.
+func Spanned(inner Parser) Parser {
+	return &SpanParser{inner}
+}
+
+// Parse parses the input.
+func (p *SpanParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r := p.inner.Parse(sc)
+	if r.Matched() {
+		return result.Success(r.TextRange(), SpannedValue{Value: r.Result(), Span: r.TextRange()})
+	}
+	return r
+}
+
+// SourceLine is the result of WithSourceLine.
+type SourceLine struct {
+	Value   interface{}
+	Line    string // the text of the line, without the newline
+	LineNum int    // starting from 0, like textpos.TextPos
+}
+
+// SourceLineParser attaches the source line to a parser's result.
+type SourceLineParser struct {
+	lines []string
+	inner Parser
+}
+
+// WithSourceLine returns a parser that runs the inner parser, and
+// returns a SourceLine holding the inner result along with the line of
+// the source where the match started. The source must be the same text
+// that is being parsed.
+func WithSourceLine(source string, inner Parser) Parser {
+	return &SourceLineParser{lines: strings.Split(source, "\n"), inner: inner}
+}
+
+// Parse parses the input.
+func (p *SourceLineParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r := p.inner.Parse(sc)
+	if !r.Matched() {
+		return r
+	}
+
+	lineNum := r.TextRange().Start().Line()
+	line := ""
+	if lineNum < len(p.lines) {
+		line = strings.TrimSuffix(p.lines[lineNum], "\r")
+	}
+	return result.Success(r.TextRange(), SourceLine{Value: r.Result(), Line: line, LineNum: lineNum})
+}
+
+// Terminated is the result of ManyTillAny.
+type Terminated struct {
+	Items           []interface{}
+	TerminatorIndex int // which of the terminators ended the list
+}
+
+// ManyTillAnyParser parses repeated items until one of several
+// terminators matches.
+type ManyTillAnyParser struct {
+	inner       Parser
+	terminators []Parser
+}
+
+// ManyTillAny returns a parser that parses the inner parser zero or
+// more times until one of the terminators matches. The terminators are
+// tried (in order) before each item, and the one that matches is
+// consumed. The result is a Terminated value recording the items and
+// the index of the terminator that matched.
+func ManyTillAny(inner Parser, terminators ...Parser) Parser {
+	return &ManyTillAnyParser{inner: inner, terminators: terminators}
+}
+
+// Parse parses the input.
+func (p *ManyTillAnyParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	items := []interface{}{}
+
+	for {
+		for i, terminator := range p.terminators {
+			if tryParse(terminator, sc).Matched() {
+				return result.Success(
+					textpos.Range(start, sc.GetPos()),
+					Terminated{Items: items, TerminatorIndex: i})
+			}
+		}
+
+		before := sc.GetPos()
+		r := p.inner.Parse(sc)
+		if !r.Matched() {
+			return r
+		}
+		if sc.GetPos() == before {
+			return fail(before, "expected a terminator")
+		}
+		items = append(items, r.Result())
+	}
+}
+
+// Recovered is the result of SkipErrors.
+type Recovered struct {
+	Value   interface{}
+	Skipped []textpos.TextPos // the positions of runes that were skipped
+}
+
+// maxSkippedRunes limits how many runes SkipErrors will skip before
+// giving up.
+const maxSkippedRunes = 100
+
+// SkipErrorsParser retries a parser after skipping bad input.
+type SkipErrorsParser struct {
+	inner Parser
+}
+
+// SkipErrors returns a parser that runs the inner parser, and if it
+// fails, skips one rune and tries again. This repeats until the inner
+// parser matches, the input runs out, or too many runes have been
+// skipped. The result is a Recovered value with the inner result and
+// the positions of the skipped runes.
+func SkipErrors(inner Parser) Parser {
+	return &SkipErrorsParser{inner}
+}
+
+// Parse parses the input.
+func (p *SkipErrorsParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	var skipped []textpos.TextPos
+
+	for {
+		r := tryParse(p.inner, sc)
+		if r.Matched() {
+			return result.Success(
+				textpos.Range(start, r.TextRange().End()),
+				Recovered{Value: r.Result(), Skipped: skipped})
+		}
+		if len(skipped) >= maxSkippedRunes {
+			return r
+		}
+
+		pos := sc.GetPos()
+		if _, err := sc.Read(); err != nil {
+			return r
+		}
+		skipped = append(skipped, pos)
+	}
+}
+
+// Pair is a key and a value, as returned by PairOf.
+type Pair struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// PairOf returns a parser that parses a key, a separator, and a value,
+// returning them as a Pair.
+func PairOf(key, separator, value Parser) Parser {
+	return Map([]Named{
+		{"key", key},
+		{"", separator},
+		{"value", value},
+	}, func(m map[string]interface{}) interface{} {
+		return Pair{Key: m["key"], Value: m["value"]}
+	})
+}
+
+// forEachSepBy parses 0+ occurrences of the inner parser separated by
+// the separator, calling fn with the result of each one. If fn returns
+// an error, parsing fails at the range of that item.
+func forEachSepBy(sc scanner.Scanner, inner, separator Parser, fn func(result.ParseResult) error) result.ParseResult {
+	start := sc.GetPos()
+
+	for first := true; ; first = false {
+		before := sc.GetPos()
+		sc.StartSnapshot()
+		if !first && !separator.Parse(sc).Matched() {
+			sc.RewindSnapshot()
+			break
+		}
+		r := inner.Parse(sc)
+		// Stop on a separator and item that consumed nothing, like Many
+		if !r.Matched() || (!first && sc.GetPos() == before) {
+			sc.RewindSnapshot()
+			break
+		}
+		sc.PopSnapshot()
+
+		if err := fn(r); err != nil {
+			return result.Failed(r.TextRange(), err)
+		}
+	}
+
+	return result.Success(textpos.Range(start, sc.GetPos()), nil)
+}
+
+// Bijection is a one-to-one mapping that can be looked up in either
+// direction, as returned by BiMap.
+type Bijection struct {
+	forward map[interface{}]interface{}
+	reverse map[interface{}]interface{}
+}
+
+// Value returns the value for the given key.
+func (b *Bijection) Value(key interface{}) (interface{}, bool) {
+	value, ok := b.forward[key]
+	return value, ok
+}
+
+// Key returns the key for the given value.
+func (b *Bijection) Key(value interface{}) (interface{}, bool) {
+	key, ok := b.reverse[value]
+	return key, ok
+}
+
+// Len returns the number of pairs.
+func (b *Bijection) Len() int {
+	return len(b.forward)
+}
+
+// BiMapParser parses pairs into a Bijection.
+type BiMapParser struct {
+	pair      Parser
+	separator Parser
+}
+
+// BiMap returns a parser that parses 0+ pairs separated by the
+// separator into a *Bijection. The pair parser must return a Pair (see
+// PairOf) whose key and value are both comparable. A repeated key or a
+// repeated value causes the parse to fail.
+func BiMap(pair, separator Parser) Parser {
+	return &BiMapParser{pair: pair, separator: separator}
+}
+
+// Parse parses the input.
+func (p *BiMapParser) Parse(sc scanner.Scanner) result.ParseResult {
+	b := &Bijection{
+		forward: map[interface{}]interface{}{},
+		reverse: map[interface{}]interface{}{},
+	}
+	r := forEachSepBy(sc, p.pair, p.separator, func(item result.ParseResult) error {
+		pair := item.Result().(Pair)
+		if _, ok := b.forward[pair.Key]; ok {
+			return fmt.Errorf("duplicate key '%v'", pair.Key)
+		}
+		if _, ok := b.reverse[pair.Value]; ok {
+			return fmt.Errorf("duplicate value '%v'", pair.Value)
+		}
+		b.forward[pair.Key] = pair.Value
+		b.reverse[pair.Value] = pair.Key
+		return nil
+	})
+	if r.Matched() {
+		return result.Success(r.TextRange(), b)
+	}
+	return r
+}
+
+// wrapper is implemented by scanners that wrap another scanner.
+type wrapper interface {
+	Unwrap() scanner.Scanner
+}
+
+// findScanner returns the first scanner in a chain of wrapped scanners
+// for which found returns true, or nil if there isn't one.
+func findScanner(sc scanner.Scanner, found func(scanner.Scanner) bool) scanner.Scanner {
+	for sc != nil {
+		if found(sc) {
+			return sc
+		}
+		w, ok := sc.(wrapper)
+		if !ok {
+			return nil
+		}
+		sc = w.Unwrap()
+	}
+	return nil
+}
+
+// depthScanner tracks how deeply nested each MaxDepthParser currently
+// is.
+type depthScanner struct {
+	scanner.Scanner
+	depths map[*MaxDepthParser]int
+}
+
+// Unwrap returns the underlying scanner.
+func (s *depthScanner) Unwrap() scanner.Scanner {
+	return s.Scanner
+}
+
+// findDepthScanner looks for a depthScanner in a chain of wrapped
+// scanners.
+func findDepthScanner(sc scanner.Scanner) *depthScanner {
+	ds, _ := findScanner(sc, func(s scanner.Scanner) bool {
+		_, ok := s.(*depthScanner)
+		return ok
+	}).(*depthScanner)
+	return ds
+}
+
+// MaxDepthParser limits how deeply a recursive parser can nest.
+type MaxDepthParser struct {
+	max   int
+	inner Parser
+}
+
+// MaxDepth returns a parser that fails with "maximum nesting depth
+// exceeded" when it is entered more than max times without returning.
+// Use it to wrap the recursive part of a grammar (the parser referenced
+// through Lazy) to guard against deeply nested input exhausting the
+// stack.
+func MaxDepth(max int, recursive Parser) Parser {
+	return &MaxDepthParser{max: max, inner: recursive}
+}
+
+// Parse parses the input.
+func (p *MaxDepthParser) Parse(sc scanner.Scanner) result.ParseResult {
+	ds := findDepthScanner(sc)
+	if ds == nil {
+		ds = &depthScanner{Scanner: sc, depths: map[*MaxDepthParser]int{}}
+		sc = ds
+	}
+
+	if ds.depths[p] >= p.max {
+		return fail(sc.GetPos(), "maximum nesting depth exceeded")
+	}
+	ds.depths[p]++
+	defer func() { ds.depths[p]-- }()
+
+	return p.inner.Parse(sc)
+}
+
+// LineContinuationParser runs a parser over input with line
+// continuations removed.
+type LineContinuationParser struct {
+	inner Parser
+}
+
+// LineContinuations returns a parser that runs the inner parser as if
+// each backslash immediately followed by a newline had been removed
+// from the input, joining the lines. Positions in results and errors
+// still refer to the original input.
+func LineContinuations(inner Parser) Parser {
+	return &LineContinuationParser{inner}
+}
+
+// Parse parses the input.
+func (p *LineContinuationParser) Parse(sc scanner.Scanner) result.ParseResult {
+	return p.inner.Parse(scanner.JoinContinuations(sc))
+}
+
+// RestrictParser rejects results that fail a policy check.
+type RestrictParser struct {
+	inner   Parser
+	allowed func(interface{}) bool
+}
+
+// Restrict returns a parser that runs the inner parser, then fails if
+// the allowed function rejects the result. This can be used to layer a
+// policy on top of a grammar, e.g. forbidding function calls in a
+// config expression.
+func Restrict(inner Parser, allowed func(result interface{}) bool) Parser {
+	return &RestrictParser{inner: inner, allowed: allowed}
+}
+
+// Parse parses the input.
+func (p *RestrictParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r := p.inner.Parse(sc)
+	if r.Matched() && !p.allowed(r.Result()) {
+		return result.Failed(r.TextRange(), fmt.Errorf("construct not allowed: %v", r.Result()))
+	}
+	return r
+}
+
+// OverflowMode says what ManyCapped does when there are more matches
+// than allowed.
+type OverflowMode int
+
+const (
+	// OverflowError makes the parse fail.
+	OverflowError OverflowMode = iota
+	// OverflowStop stops at the limit and leaves the rest unparsed.
+	OverflowStop
+)
+
+// CappedParser matches 0+ occurrences, up to a limit.
+type CappedParser struct {
+	inner      Parser
+	limit      int
+	onOverflow OverflowMode
+}
+
+// ManyCapped returns a parser that matches the inner parser zero or
+// more times, like ListOf, but never collects more than limit results.
+// If the inner parser would match again after that, onOverflow decides
+// whether the parse fails or stops successfully.
+func ManyCapped(inner Parser, limit int, onOverflow OverflowMode) Parser {
+	return &CappedParser{inner: inner, limit: limit, onOverflow: onOverflow}
+}
+
+// Parse parses the input.
+func (p *CappedParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	results := []interface{}{}
+
+	for {
+		before := sc.GetPos()
+		sc.StartSnapshot()
+		innerResult := p.inner.Parse(sc)
+		if !innerResult.Matched() || sc.GetPos() == before {
+			sc.RewindSnapshot()
+			break
+		}
+
+		if len(results) == p.limit {
+			if p.onOverflow == OverflowError {
+				sc.PopSnapshot()
+				return fail(before, "more than %d matches", p.limit)
+			}
+			sc.RewindSnapshot()
+			break
+		}
+
+		sc.PopSnapshot()
+		results = append(results, innerResult.Result())
+	}
+
+	return result.Success(textpos.Range(start, sc.GetPos()), results)
+}
+
+// CountRangeParser matches between min and max occurrences.
+type CountRangeParser struct {
+	min, max int
+	inner    Parser
+}
+
+// CountRange returns a parser that matches the inner parser as many
+// times as it can, up to max, and fails if that is fewer than min
+// times. A max of -1 means there is no upper bound. Like ListOf, it
+// returns a list of the results. A match that consumes no input ends
+// the repetition, since it would match the same way every time; it is
+// repeated as needed to reach min.
+func CountRange(min, max int, inner Parser) Parser {
+	return &CountRangeParser{min: min, max: max, inner: inner}
+}
+
+// Parse parses the input.
+func (p *CountRangeParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	results := []interface{}{}
+
+	sc.StartSnapshot()
+	for p.max < 0 || len(results) < p.max {
+		before := sc.GetPos()
+		sc.StartSnapshot()
+		innerResult := p.inner.Parse(sc)
+		if !innerResult.Matched() {
+			sc.RewindSnapshot()
+			if len(results) < p.min {
+				sc.RewindSnapshot()
+				return innerResult
+			}
+			break
+		}
+		sc.PopSnapshot()
+		results = append(results, innerResult.Result())
+
+		if sc.GetPos() == before {
+			for len(results) < p.min {
+				results = append(results, innerResult.Result())
+			}
+			break
+		}
+	}
+	sc.PopSnapshot()
+
+	return result.Success(textpos.Range(start, sc.GetPos()), results)
+}
+
+// previousRune finds the rune before the current position, if any
+// scanner in a chain of wrapped scanners can look behind.
+func previousRune(sc scanner.Scanner) (rune, bool) {
+	lb, ok := findScanner(sc, func(s scanner.Scanner) bool {
+		_, ok := s.(scanner.LookBehind)
+		return ok
+	}).(scanner.LookBehind)
+	if !ok {
+		return 0, false
+	}
+	return lb.Previous()
+}
+
+// isWordRune returns whether the rune can be part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// WordParser parses a token that is a whole word.
+type WordParser struct {
+	token       Parser
+	checkBefore bool
+}
+
+// Word returns a parser that parses the exact string given, but only
+// when it is not preceded or followed by a letter or digit. E.g.
+// Word("cat") matches in "a cat sat" but not in "category" or "scat".
+// When the scanner can't look behind, the start of the match is
+// assumed to be a word boundary.
+func Word(token string) Parser {
+	return &WordParser{token: Token(token), checkBefore: true}
+}
+
+// TokenBoundary returns a parser that parses the exact string given,
+// but only when it is followed by something other than a letter or
+// digit (or by the end of the input). E.g. TokenBoundary("return")
+// matches "return x" but not "returning".
+func TokenBoundary(token string) Parser {
+	return &WordParser{token: Token(token), checkBefore: false}
+}
+
+// Parse parses the input.
+func (p *WordParser) Parse(sc scanner.Scanner) result.ParseResult {
+	if p.checkBefore {
+		if prev, ok := previousRune(sc); ok && isWordRune(prev) {
+			return fail(sc.GetPos(), "expected a word boundary before the word")
+		}
+	}
+
+	r := p.token.Parse(sc)
+	if !r.Matched() {
+		return r
+	}
+
+	sc.StartSnapshot()
+	next, err := sc.Read()
+	sc.RewindSnapshot()
+	if err == nil && isWordRune(next) {
+		return fail(sc.GetPos(), "expected a word boundary after the word")
+	}
+	return r
+}
+
+// EmbeddedParser parses a delimited region with a separate parser.
+type EmbeddedParser struct {
+	open    Parser
+	close   Parser
+	content Parser
+}
+
+// Embedded returns a parser that finds the region between the open
+// and close parsers (stopping at the first match of close), then runs
+// the content parser over exactly the text of that region. The content
+// parser must consume the whole region. Positions in errors from the
+// content parser refer to the original input.
+func Embedded(open, close, content Parser) Parser {
+	return &EmbeddedParser{open: open, close: close, content: content}
+}
+
+// Parse parses the input.
+func (p *EmbeddedParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	if r := p.open.Parse(sc); !r.Matched() {
+		return r
+	}
+
+	contentStart := sc.GetPos()
+	var buffer bytes.Buffer
+	for !tryParse(p.close, sc).Matched() {
+		r, err := sc.Read()
+		if err != nil {
+			return fail(sc.GetPos(), "expected the end of the embedded section, got error %v", err)
+		}
+		buffer.WriteRune(r)
+	}
+
+	sub := scanner.FromStringAt(buffer.String(), contentStart)
+	r := Sequence(p.content, EOF()).Parse(sub)
+	if !r.Matched() {
+		return r
+	}
+	return result.Success(
+		textpos.Range(start, sc.GetPos()),
+		r.Result().([]interface{})[0])
+}
+
+// limitScanner stops reading from the underlying scanner after a
+// fixed number of runes.
+type limitScanner struct {
+	scanner.Scanner
+	left  int
+	marks []int
+}
+
+// Unwrap returns the underlying scanner.
+func (s *limitScanner) Unwrap() scanner.Scanner {
+	return s.Scanner
+}
+
+// Read reads a rune, or returns an EOFError once the limit is reached.
+func (s *limitScanner) Read() (rune, error) {
+	if s.left <= 0 {
+		return 0, &scanner.EOFError{}
+	}
+	r, err := s.Scanner.Read()
+	if err == nil {
+		s.left--
+	}
+	return r, err
+}
+
+// StartSnapshot takes a snapshot of the underlying scanner and the
+// remaining limit.
+func (s *limitScanner) StartSnapshot() {
+	s.marks = append(s.marks, s.left)
+	s.Scanner.StartSnapshot()
+}
+
+// RewindSnapshot rewinds the underlying scanner and the remaining
+// limit.
+func (s *limitScanner) RewindSnapshot() {
+	last := len(s.marks) - 1
+	s.left = s.marks[last]
+	s.marks = s.marks[:last]
+	s.Scanner.RewindSnapshot()
+}
+
+// PopSnapshot drops the last snapshot.
+func (s *limitScanner) PopSnapshot() {
+	s.marks = s.marks[:len(s.marks)-1]
+	s.Scanner.PopSnapshot()
+}
+
+// ColumnParser parses a fixed-width column.
+type ColumnParser struct {
+	startCol int
+	width    int
+	inner    Parser
+}
+
+// Column returns a parser for a fixed-width column of a table. It
+// fails if parsing doesn't begin at startCol. The inner parser can
+// read at most width runes, and any part of the column it doesn't
+// consume must be spaces, which are skipped so the next column starts
+// aligned.
+func Column(startCol, width int, inner Parser) Parser {
+	return &ColumnParser{startCol: startCol, width: width, inner: inner}
+}
+
+// Parse parses the input.
+func (p *ColumnParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	if start.Col() != p.startCol {
+		return fail(start, "expected column %d, got column %d", p.startCol, start.Col())
+	}
+
+	limited := &limitScanner{Scanner: sc, left: p.width}
+	r := p.inner.Parse(limited)
+	if !r.Matched() {
+		return r
+	}
+	for limited.left > 0 {
+		sc.StartSnapshot()
+		c, err := sc.Read()
+		if err != nil || c == '\n' {
+			sc.RewindSnapshot()
+			break
+		}
+		sc.PopSnapshot()
+		if c != ' ' {
+			return fail(sc.GetPos(), "misaligned column, got '%c' where padding was expected", c)
+		}
+		limited.left--
+	}
+
+	return result.Success(textpos.Range(start, sc.GetPos()), r.Result())
+}
+
+// Category is a named class of runes, for use with Classify.
+type Category struct {
+	Pred func(rune) bool
+	Tag  string
+}
+
+// Classified is the result of Classify.
+type Classified struct {
+	Rune rune
+	Tag  string
+}
+
+// ClassifyParser parses a single rune and tags it with its category.
+type ClassifyParser struct {
+	categories []Category
+}
+
+// Classify returns a parser that parses a single rune and returns a
+// Classified value tagged with the first category whose predicate
+// accepts it. It fails if no category accepts the rune.
+func Classify(categories []Category) Parser {
+	return &ClassifyParser{categories}
+}
+
+// Parse parses the input.
+func (p *ClassifyParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	r, err := sc.Read()
+	if err != nil {
+		return fail(sc.GetPos(), "expected a character, got error %v", err)
+	}
+	for _, category := range p.categories {
+		if category.Pred(r) {
+			return result.Success(
+				textpos.Range(start, sc.GetPos()),
+				Classified{Rune: r, Tag: category.Tag})
+		}
+	}
+	return fail(sc.GetPos(), "character '%c' is not in any category", r)
+}
+
+// capture is a single value captured by Named2.
+type capture struct {
+	name  string
+	value interface{}
+}
+
+// captureScanner collects the values captured while parsing, dropping
+// any that were captured in input that is later rewound.
+type captureScanner struct {
+	scanner.Scanner
+	captures []capture
+	marks    []int
+}
+
+// Unwrap returns the underlying scanner.
+func (s *captureScanner) Unwrap() scanner.Scanner {
+	return s.Scanner
+}
+
+// StartSnapshot takes a snapshot of the underlying scanner and the
+// captures.
+func (s *captureScanner) StartSnapshot() {
+	s.marks = append(s.marks, len(s.captures))
+	s.Scanner.StartSnapshot()
+}
+
+// RewindSnapshot rewinds the underlying scanner and drops the captures
+// made since the snapshot.
+func (s *captureScanner) RewindSnapshot() {
+	last := len(s.marks) - 1
+	s.captures = s.captures[:s.marks[last]]
+	s.marks = s.marks[:last]
+	s.Scanner.RewindSnapshot()
+}
+
+// PopSnapshot drops the last snapshot.
+func (s *captureScanner) PopSnapshot() {
+	s.marks = s.marks[:len(s.marks)-1]
+	s.Scanner.PopSnapshot()
+}
+
+// CaptureParser records the result of a parser under a name.
+type CaptureParser struct {
+	name  string
+	inner Parser
+}
+
+// Named2 returns a parser that runs the inner parser and, if it
+// matches, records its result under the given name for the enclosing
+// CollectCaptures, much like a named group in a regular expression.
+// The result itself is passed through unchanged.
+func Named2(name string, inner Parser) Parser {
+	return &CaptureParser{name: name, inner: inner}
+}
+
+// Parse parses the input.
+func (p *CaptureParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r := p.inner.Parse(sc)
+	if !r.Matched() {
+		return r
+	}
+	cs, ok := findScanner(sc, func(s scanner.Scanner) bool {
+		_, ok := s.(*captureScanner)
+		return ok
+	}).(*captureScanner)
+	if ok {
+		cs.captures = append(cs.captures, capture{name: p.name, value: r.Result()})
+	}
+	return r
+}
+
+// CollectCapturesParser gathers the values captured by Named2.
+type CollectCapturesParser struct {
+	inner Parser
+}
+
+// CollectCaptures returns a parser that runs the inner parser, and
+// returns a map[string]interface{} of all the values captured with
+// Named2 anywhere inside it, however deeply nested. If a name is
+// captured more than once, the last value wins.
+func CollectCaptures(inner Parser) Parser {
+	return &CollectCapturesParser{inner}
+}
+
+// Parse parses the input.
+func (p *CollectCapturesParser) Parse(sc scanner.Scanner) result.ParseResult {
+	cs := &captureScanner{Scanner: sc}
+	r := p.inner.Parse(cs)
+	if !r.Matched() {
+		return r
+	}
+
+	captures := make(map[string]interface{}, len(cs.captures))
+	for _, c := range cs.captures {
+		captures[c.name] = c.value
+	}
+	return result.Success(r.TextRange(), captures)
+}
+
+// BuildStep is one step of Build: a parser, and a function that
+// applies its result to the value being built. Apply may be nil to
+// ignore the result.
+type BuildStep struct {
+	Parser Parser
+	Apply  func(acc, val interface{})
+}
+
+// BuildParser builds a value step by step as it parses.
+type BuildParser struct {
+	init  func() interface{}
+	steps []BuildStep
+}
+
+// Build returns a parser that creates a value with init, then runs
+// each step's parser in sequence, applying each result to the value
+// as it goes. The result is the built value. This is an alternative to
+// Map that avoids building an intermediate map; init is called on
+// every parse, so it should return a new value each time.
+func Build(init func() interface{}, steps ...BuildStep) Parser {
+	return &BuildParser{init: init, steps: steps}
+}
+
+// Parse parses the input.
+func (p *BuildParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	acc := p.init()
+
+	for _, step := range p.steps {
+		r := step.Parser.Parse(sc)
+		if !r.Matched() {
+			return r
+		}
+		if step.Apply != nil {
+			step.Apply(acc, r.Result())
+		}
+	}
+
+	return result.Success(textpos.Range(start, sc.GetPos()), acc)
+}
+
+// Presence is the result of MaybePresent.
+type Presence struct {
+	Present bool
+	Value   interface{}
+}
+
+// MaybePresentParser tries the inner parser, reporting whether it
+// matched.
+type MaybePresentParser struct {
+	inner Parser
+}
+
+// MaybePresent works like Maybe, but returns a Presence so that an
+// inner parser that matched empty input can be told apart from one
+// that didn't match at all.
+func MaybePresent(inner Parser) Parser {
+	return &MaybePresentParser{inner}
+}
+
+// Parse parses the input.
+func (p *MaybePresentParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r := tryParse(p.inner, sc)
+	if r.Matched() {
+		return result.Success(r.TextRange(), Presence{Present: true, Value: r.Result()})
+	}
+	return result.Success(textpos.Single(sc.GetPos()), Presence{})
+}
+
+// RawPresence is the result of MaybeRaw.
+type RawPresence struct {
+	Present bool
+	Raw     string // the exact text matched, if present
+}
+
+// MaybeRawParser tries the inner parser, keeping the text it matched.
+type MaybeRawParser struct {
+	inner Parser
+}
+
+// MaybeRaw works like Maybe, but returns a RawPresence holding the
+// exact source text the inner parser matched, rather than its result.
+// This is useful for formatters that must keep optional parts of the
+// input (such as comments or spacing) as they were written.
+func MaybeRaw(inner Parser) Parser {
+	return &MaybeRawParser{inner}
+}
+
+// Parse parses the input.
+func (p *MaybeRawParser) Parse(sc scanner.Scanner) result.ParseResult {
+	sc.StartSnapshot()
+	r, text := parseRecorded(p.inner, sc)
+	if !r.Matched() {
+		sc.RewindSnapshot()
+		return result.Success(textpos.Single(sc.GetPos()), RawPresence{})
+	}
+	sc.PopSnapshot()
+	return result.Success(r.TextRange(), RawPresence{Present: true, Raw: string(text)})
+}
+
+// UniqueKeyParser parses a list of items whose keys must be unique.
+type UniqueKeyParser struct {
+	pair      Parser
+	separator Parser
+	keyOf     func(interface{}) string
+}
+
+// UniqueKeyMap returns a parser that parses 0+ pairs separated by the
+// separator, failing at the first pair whose key (as found by keyOf)
+// was already seen. The result is a []interface{} of the pairs, in the
+// order they appeared.
+func UniqueKeyMap(pair, separator Parser, keyOf func(interface{}) string) Parser {
+	return &UniqueKeyParser{pair: pair, separator: separator, keyOf: keyOf}
+}
+
+// Parse parses the input.
+func (p *UniqueKeyParser) Parse(sc scanner.Scanner) result.ParseResult {
+	seen := map[string]struct{}{}
+	pairs := []interface{}{}
+	var duplicate result.ParseResult
+	r := forEachSepBy(sc, p.pair, p.separator, func(item result.ParseResult) error {
+		key := p.keyOf(item.Result())
+		if _, ok := seen[key]; ok {
+			err := fmt.Errorf("duplicate key '%s'", key)
+			duplicate = result.Failed(textpos.Single(item.TextRange().Start()), err)
+			return err
+		}
+		seen[key] = struct{}{}
+		pairs = append(pairs, item.Result())
+		return nil
+	})
+	if r.Matched() {
+		return result.Success(r.TextRange(), pairs)
+	}
+	// Report a duplicate at its start rather than its end
+	if duplicate != nil {
+		return duplicate
+	}
+	return r
+}
+
+// Batch is the result of TryEach.
+type Batch struct {
+	Results []interface{}
+	Errors  []error
+}
+
+// TryEachParser parses separated items, recovering from bad ones.
+type TryEachParser struct {
+	inner     Parser
+	separator Parser
+}
+
+// TryEach returns a parser that parses a list of items separated by the
+// separator, where each item is parsed independently: if an item fails
+// to parse (or is followed by something other than a separator), its
+// error is recorded and the parser skips ahead to the next separator.
+// The result is a Batch of the successful results and the errors. It
+// consumes input up to the end or the end of the last item.
+func TryEach(inner, separator Parser) Parser {
+	return &TryEachParser{inner: inner, separator: separator}
+}
+
+// atEOF returns whether the scanner is at the end of the input.
+func atEOF(sc scanner.Scanner) bool {
+	sc.StartSnapshot()
+	_, err := sc.Read()
+	sc.RewindSnapshot()
+	return err != nil
+}
+
+// atEndOfItem returns whether the scanner is at a separator or at the
+// end of the input, without consuming anything.
+func (p *TryEachParser) atEndOfItem(sc scanner.Scanner) bool {
+	if atEOF(sc) {
+		return true
+	}
+	sc.StartSnapshot()
+	matched := p.separator.Parse(sc).Matched()
+	sc.RewindSnapshot()
+	return matched
+}
+
+// Parse parses the input.
+func (p *TryEachParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	batch := Batch{Results: []interface{}{}}
+
+	for first := true; ; first = false {
+		if first && atEOF(sc) {
+			break
+		}
+		before := sc.GetPos()
+
+		sc.StartSnapshot()
+		r := p.inner.Parse(sc)
+		if r.Matched() && p.atEndOfItem(sc) {
+			sc.PopSnapshot()
+			batch.Results = append(batch.Results, r.Result())
+		} else {
+			if r.Matched() {
+				r = fail(sc.GetPos(), "unexpected input after item")
+			}
+			sc.RewindSnapshot()
+			batch.Errors = append(batch.Errors, r.Error())
+			for !p.atEndOfItem(sc) {
+				sc.Read()
+			}
+		}
+
+		// Stop if the item and separator consumed nothing, like Many
+		if !tryParse(p.separator, sc).Matched() || sc.GetPos() == before {
+			break
+		}
+	}
+
+	return result.Success(textpos.Range(start, sc.GetPos()), batch)
+}
+
+// ASCIIParser rejects matches containing non-ASCII characters.
+type ASCIIParser struct {
+	inner Parser
+}
+
+// ASCIIOnly returns a parser that runs the inner parser, then fails if
+// the text it matched contains any non-ASCII character.
+func ASCIIOnly(inner Parser) Parser {
+	return &ASCIIParser{inner}
+}
+
+// Parse parses the input.
+func (p *ASCIIParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	r, text := parseRecorded(p.inner, sc)
+	if !r.Matched() {
+		return r
+	}
+
+	pos := start
+	for _, c := range text {
+		if c > unicode.MaxASCII {
+			return result.Failed(
+				textpos.Single(pos),
+				fmt.Errorf("non-ASCII character '%c'", c))
+		}
+		pos = pos.Advance(c)
+	}
+	return r
+}
+
+// OnErrorParser replaces the error from a parser with a custom
+// message.
+type OnErrorParser struct {
+	inner Parser
+	fn    func(found string, pos textpos.TextPos) string
+}
+
+// OnError returns a parser that runs the inner parser, and if it fails,
+// replaces the error with the message returned by fn. fn is given the
+// character found where the parse failed (or "" at the end of the
+// input) and its position.
+func OnError(inner Parser, fn func(found string, pos textpos.TextPos) string) Parser {
+	return &OnErrorParser{inner: inner, fn: fn}
+}
+
+// Parse parses the input.
+func (p *OnErrorParser) Parse(sc scanner.Scanner) result.ParseResult {
+	sc.StartSnapshot()
+	r := p.inner.Parse(sc)
+	if r.Matched() {
+		sc.PopSnapshot()
+		return r
+	}
+
+	// Re-read up to the error to find the character that caused it
+	sc.RewindSnapshot()
+	found, pos := "", sc.GetPos()
+	for {
+		before := sc.GetPos()
+		c, err := sc.Read()
+		if err != nil {
+			break
+		}
+		found, pos = string(c), before
+		if !sc.GetPos().Before(r.TextRange().End()) {
+			break
+		}
+	}
+
+	return result.Failed(r.TextRange(), errors.New(p.fn(found, pos)))
+}
+
+// WithTrailing is the result of OptionalTrailing.
+type WithTrailing struct {
+	Main        interface{}
+	Trailing    interface{}
+	HasTrailing bool
+}
+
+// OptionalTrailingParser parses a main section with an optional
+// trailing section.
+type OptionalTrailingParser struct {
+	main     Parser
+	trailing Parser
+}
+
+// OptionalTrailing returns a parser that parses main, then tries to
+// parse trailing. If trailing doesn't match, the input it looked at is
+// left unconsumed. The result is a WithTrailing value.
+func OptionalTrailing(main, trailing Parser) Parser {
+	return &OptionalTrailingParser{main: main, trailing: trailing}
+}
+
+// Parse parses the input.
+func (p *OptionalTrailingParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	mainResult := p.main.Parse(sc)
+	if !mainResult.Matched() {
+		return mainResult
+	}
+
+	out := WithTrailing{Main: mainResult.Result()}
+	if r := tryParse(p.trailing, sc); r.Matched() {
+		out.Trailing = r.Result()
+		out.HasTrailing = true
+	}
+	return result.Success(textpos.Range(start, sc.GetPos()), out)
+}
+
+// HashedValue is the result of Hashed.
+type HashedValue struct {
+	Value interface{}
+	Hash  uint64
+}
+
+// HashParser hashes the text matched by a parser.
+type HashParser struct {
+	inner Parser
+}
+
+// Hashed returns a parser that runs the inner parser, and returns a
+// HashedValue with its result and an FNV-1a hash of the text it
+// matched. Identical text always produces the same hash, so this can
+// be used to tell whether a region changed between parses.
+func Hashed(inner Parser) Parser {
+	return &HashParser{inner}
+}
+
+// Parse parses the input.
+func (p *HashParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r, text := parseRecorded(p.inner, sc)
+	if !r.Matched() {
+		return r
+	}
+	h := fnv.New64a()
+	h.Write([]byte(string(text)))
+	return result.Success(r.TextRange(), HashedValue{Value: r.Result(), Hash: h.Sum64()})
+}
+
+// furthest returns whichever of the two failures got further into the
+// input, preferring the first when they are tied.
+func furthest(a, b result.ParseResult) result.ParseResult {
+	if a == nil || a.TextRange().End().Before(b.TextRange().End()) {
+		return b
+	}
+	return a
+}
+
+// FactoredParser parses a common prefix followed by one of several
+// branches.
+type FactoredParser struct {
+	common   Parser
+	branches []Parser
+}
+
+// Factored returns a parser equivalent to Sequence(common,
+// Or(branches...)), i.e. the left-factored form of
+// Or(Sequence(common, b1), Sequence(common, b2), ...), with common
+// parsed exactly once. If every branch fails, the failure that got
+// furthest into the input is returned.
+func Factored(common Parser, branches ...Parser) Parser {
+	return &FactoredParser{common: common, branches: branches}
+}
+
+// Parse parses the input.
+func (p *FactoredParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	commonResult := p.common.Parse(sc)
+	if !commonResult.Matched() {
+		return commonResult
+	}
+
+	var best result.ParseResult
+	for _, branch := range p.branches {
+		r := tryParse(branch, sc)
+		if r.Matched() {
+			return result.Success(
+				textpos.Range(start, sc.GetPos()),
+				cleanupResult([]interface{}{commonResult.Result(), r.Result()}))
+		}
+		best = furthest(best, r)
+	}
+
+	if best == nil {
+		return fail(sc.GetPos(), "no parser matched")
+	}
+	return best
+}
+
+// DictionaryParser checks parsed words against a dictionary.
+type DictionaryParser struct {
+	word Parser
+	dict map[string]struct{}
+}
+
+// InDictionary returns a parser that runs the word parser, then fails
+// with "unknown word" if the word (its string result) isn't in the
+// dictionary.
+func InDictionary(word Parser, dict map[string]struct{}) Parser {
+	return &DictionaryParser{word: word, dict: dict}
+}
+
+// Parse parses the input.
+func (p *DictionaryParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r := p.word.Parse(sc)
+	if !r.Matched() {
+		return r
+	}
+	word := fmt.Sprint(r.Result())
+	if _, ok := p.dict[word]; !ok {
+		return result.Failed(r.TextRange(), fmt.Errorf("unknown word '%s'", word))
+	}
+	return r
+}
+
+// TypedFieldsParser parses key-value pairs, choosing the value parser
+// by key.
+type TypedFieldsParser struct {
+	key       Parser
+	schema    map[string]Parser
+	separator Parser
+	pairSep   Parser
+}
+
+// TypedFields returns a parser that parses 0+ `key<kvSep>value` pairs
+// separated by pairSep, into a map[string]interface{}. The value of
+// each pair is parsed with the schema's parser for that key, so each
+// key can have a differently typed value. Keys are made of letters,
+// digits, '_' and '-'. Unknown keys cause the parse to fail.
+func TypedFields(schema map[string]Parser, kvSep, pairSep Parser) Parser {
+	return &TypedFieldsParser{
+		key:       Many1(Or(AlphaNum(), AnyChar('_', '-'))),
+		schema:    schema,
+		separator: kvSep,
+		pairSep:   pairSep,
+	}
+}
+
+// Parse parses the input.
+func (p *TypedFieldsParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	fields := map[string]interface{}{}
+
+	for first := true; ; first = false {
+		sc.StartSnapshot()
+		if !first && !p.pairSep.Parse(sc).Matched() {
+			sc.RewindSnapshot()
+			break
+		}
+		keyStart := sc.GetPos()
+		keyResult := p.key.Parse(sc)
+		if !keyResult.Matched() {
+			sc.RewindSnapshot()
+			break
+		}
+		sc.PopSnapshot()
+
+		key := keyResult.Result().(string)
+		valueParser, ok := p.schema[key]
+		if !ok {
+			return result.Failed(textpos.Single(keyStart), fmt.Errorf("unknown key '%s'", key))
+		}
+		if r := p.separator.Parse(sc); !r.Matched() {
+			return r
+		}
+		r := valueParser.Parse(sc)
+		if !r.Matched() {
+			return r
+		}
+		fields[key] = r.Result()
+	}
+
+	return result.Success(textpos.Range(start, sc.GetPos()), fields)
+}
+
+// PredicateParser parses a single rune accepted by a predicate.
+type PredicateParser struct {
+	pred        func(rune) bool
+	description string // what the predicate accepts, if known
+}
+
+// Satisfy returns a parser that parses a single rune for which the
+// predicate returns true, e.g. Satisfy(unicode.IsLetter).
+func Satisfy(pred func(rune) bool) Parser {
+	return &PredicateParser{pred: pred}
+}
+
+// Parse parses the input.
+func (p *PredicateParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	r, err := sc.Read()
+	if err != nil {
+		if p.description == "" {
+			return fail(sc.GetPos(), "expected a character, got error %v", err)
+		}
+		return fail(sc.GetPos(), "expected %s, got error %v", p.description, err)
+	}
+	if !p.pred(r) {
+		if p.description == "" {
+			return fail(sc.GetPos(), "unexpected character '%c'", r)
+		}
+		return fail(sc.GetPos(), "expected %s, got '%c'", p.description, r)
+	}
+	return result.Success(textpos.Range(start, sc.GetPos()), string(r))
+}
+
+// TakeWhileParser reads a run of runes matching a predicate.
+type TakeWhileParser struct {
+	pred     func(rune) bool
+	atLeast1 bool
+}
+
+// TakeWhile returns a parser that reads runes for as long as the
+// predicate returns true, returning them as a string (which may be
+// empty). It does the same as Many(Satisfy(pred)), but faster.
+func TakeWhile(pred func(rune) bool) Parser {
+	return &TakeWhileParser{pred: pred}
+}
+
+// TakeWhile1 works like TakeWhile, but requires at least one rune to
+// match.
+func TakeWhile1(pred func(rune) bool) Parser {
+	return &TakeWhileParser{pred: pred, atLeast1: true}
+}
+
+// Parse parses the input.
+func (p *TakeWhileParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	var buffer bytes.Buffer
+
+	for {
+		sc.StartSnapshot()
+		r, err := sc.Read()
+		if err != nil || !p.pred(r) {
+			if p.atLeast1 && buffer.Len() == 0 {
+				pos := sc.GetPos()
+				sc.PopSnapshot()
+				if err != nil {
+					return fail(pos, "expected a character, got error %v", err)
+				}
+				return fail(pos, "unexpected character '%c'", r)
+			}
+			sc.RewindSnapshot()
+			break
+		}
+		sc.PopSnapshot()
+		buffer.WriteRune(r)
+	}
+
+	return result.Success(textpos.Range(start, sc.GetPos()), buffer.String())
+}
+
+// TakeUntil returns a parser that reads runes up to (but not
+// including) the first one for which the predicate returns true, or the
+// end of the input, returning them as a string (which may be empty).
+func TakeUntil(pred func(rune) bool) Parser {
+	return TakeWhile(func(r rune) bool { return !pred(r) })
+}
+
+// AmbiguityParser tries every alternative to look for ambiguity.
+type AmbiguityParser struct {
+	alts []Parser
+}
+
+// AmbiguityCheck returns a parser that tries every alternative and
+// returns the result of the one that matches the longest text, failing
+// if more than one of them matches that same text. This is meant for
+// debugging grammars, since it parses the input once per alternative.
+// Every alternative is rewound after it is tried. If the scanner can
+// seek, it is then moved past the longest match without parsing it
+// again, so side effects of the alternatives (like Named2 captures)
+// are not kept. Otherwise the longest alternative is parsed again.
+func AmbiguityCheck(alts ...Parser) Parser {
+	return &AmbiguityParser{alts}
+}
+
+// Parse parses the input.
+func (p *AmbiguityParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	var failure result.ParseResult
+	var longest result.ParseResult
+	var longestEnd textpos.TextPos
+	var longestOffset int
+	ambiguous := []int{}
+
+	for i, inner := range p.alts {
+		sc.StartSnapshot()
+		innerResult := inner.Parse(sc)
+		end := sc.GetPos()
+		offset := offsetOf(sc)
+		sc.RewindSnapshot()
+
+		if !innerResult.Matched() {
+			failure = furthest(failure, innerResult)
+			continue
+		}
+		if longest == nil || longestEnd.Before(end) {
+			longest = innerResult
+			longestEnd = end
+			longestOffset = offset
+			ambiguous = []int{i}
+		} else if end == longestEnd {
+			ambiguous = append(ambiguous, i)
+		}
+	}
+
+	if longest == nil {
+		if failure == nil {
+			return fail(start, "no parser matched")
+		}
+		return failure
+	}
+	if len(ambiguous) > 1 {
+		return result.Failed(
+			textpos.Range(start, longestEnd),
+			fmt.Errorf("ambiguous input: alternatives %v all match", ambiguous))
+	}
+	if seekerOf(sc) == nil {
+		return p.alts[ambiguous[0]].Parse(sc)
+	}
+	skipTo(sc, longestOffset, longestEnd)
+	return longest
+}
+
+// fractionParts holds the text of the parts of a fraction.
+type fractionParts struct {
+	negative                bool
+	whole, numerator, denom string
+}
+
+// FractionParser parses whole numbers, fractions and mixed numbers.
+type FractionParser struct {
+	parts Parser
+}
+
+// Fraction returns a parser for a whole number ("3"), a fraction
+// ("1/2") or a mixed number ("3 1/2"), each with an optional sign,
+// returning a *big.Rat. A fraction with a zero denominator fails.
+func Fraction() Parser {
+	ratio := Map([]Named{
+		{"numerator", Digits()},
+		{"", Sequence(Whitespace(), Char('/'), Whitespace())},
+		{"denom", Digits()},
+	}, func(m map[string]interface{}) interface{} {
+		return fractionParts{numerator: m["numerator"].(string), denom: m["denom"].(string)}
+	})
+	mixed := Map([]Named{
+		{"whole", Digits()},
+		{"", Many1(AnyChar(' ', '\t'))},
+		{"ratio", ratio},
+	}, func(m map[string]interface{}) interface{} {
+		parts := m["ratio"].(fractionParts)
+		parts.whole = m["whole"].(string)
+		return parts
+	})
+	whole := ParseWith(Digits(), func(digits interface{}) interface{} {
+		return fractionParts{whole: digits.(string)}
+	})
+	return &FractionParser{Map([]Named{
+		{"sign", Maybe(AnyChar('-', '+'))},
+		{"parts", Or(mixed, ratio, whole)},
+	}, func(m map[string]interface{}) interface{} {
+		parts := m["parts"].(fractionParts)
+		parts.negative = m["sign"] == "-"
+		return parts
+	})}
+}
+
+// Parse parses the input.
+func (p *FractionParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r := p.parts.Parse(sc)
+	if !r.Matched() {
+		return r
+	}
+
+	parts := r.Result().(fractionParts)
+	value := new(big.Rat)
+	if parts.denom != "" {
+		num, _ := new(big.Int).SetString(parts.numerator, 10)
+		denom, _ := new(big.Int).SetString(parts.denom, 10)
+		if denom.Sign() == 0 {
+			return result.Failed(r.TextRange(), errors.New("division by zero in fraction"))
+		}
+		value.SetFrac(num, denom)
+	}
+	if parts.whole != "" {
+		whole, _ := new(big.Int).SetString(parts.whole, 10)
+		value.Add(value, new(big.Rat).SetInt(whole))
+	}
+	if parts.negative {
+		value.Neg(value)
+	}
+	return result.Success(r.TextRange(), value)
+}
+
+// Fenced is the result of FencedBlock.
+type Fenced struct {
+	Info    string // the text after the opening fence, trimmed
+	Content string // the lines between the fences, exactly as written
+}
+
+// FencedBlockParser parses a Markdown style fenced block.
+type FencedBlockParser struct {
+	fence    rune
+	minCount int
+}
+
+// FencedBlock returns a parser for a block of lines between fences,
+// like a Markdown code block, returning a Fenced value. The fence gives
+// the character and the minimum length of the fences, e.g. "```". The
+// opening fence may be longer, in which case the closing fence must be
+// at least as long, so that shorter fences can appear in the content.
+// The opening fence can be followed by an info string such as a
+// language name. The newline after the closing fence isn't consumed.
+func FencedBlock(fence string) Parser {
+	rs := []rune(fence)
+	if len(rs) == 0 {
+		panic("parser: FencedBlock needs a non-empty fence")
+	}
+	return &FencedBlockParser{fence: rs[0], minCount: len(rs)}
+}
+
+// Parse parses the input.
+func (p *FencedBlockParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	count := p.readFence(sc)
+	if count < p.minCount {
+		return fail(sc.GetPos(), "expected a fence of at least %d '%c'", p.minCount, p.fence)
+	}
+
+	info, ok := readLine(sc)
+	if !ok {
+		return fail(sc.GetPos(), "unterminated fenced block")
+	}
+
+	var content bytes.Buffer
+	for {
+		if p.atClosingFence(sc, count) {
+			return result.Success(
+				textpos.Range(start, sc.GetPos()),
+				Fenced{Info: strings.TrimSpace(info), Content: content.String()})
+		}
+
+		line, ok := readLine(sc)
+		if !ok {
+			return fail(sc.GetPos(), "unterminated fenced block")
+		}
+		content.WriteString(line)
+		content.WriteRune('\n')
+	}
+}
+
+// readFence reads as many fence characters as there are, returning how
+// many it read.
+func (p *FencedBlockParser) readFence(sc scanner.Scanner) int {
+	count := 0
+	for {
+		sc.StartSnapshot()
+		r, err := sc.Read()
+		if err != nil || r != p.fence {
+			sc.RewindSnapshot()
+			return count
+		}
+		sc.PopSnapshot()
+		count++
+	}
+}
+
+// atClosingFence consumes a closing fence at least count long that is
+// alone on its line (apart from trailing spaces), if there is one.
+func (p *FencedBlockParser) atClosingFence(sc scanner.Scanner, count int) bool {
+	sc.StartSnapshot()
+	if p.readFence(sc) < count {
+		sc.RewindSnapshot()
+		return false
+	}
+	for {
+		sc.StartSnapshot()
+		r, err := sc.Read()
+		sc.RewindSnapshot()
+		if err != nil || r == '\n' {
+			sc.PopSnapshot()
+			return true
+		}
+		if r != ' ' && r != '\t' {
+			sc.RewindSnapshot()
+			return false
+		}
+		sc.Read()
+	}
+}
+
+// readLine reads the rest of the line, consuming the newline but not
+// including it in the result. It returns false if the input ends
+// before the newline.
+func readLine(sc scanner.Scanner) (string, bool) {
+	var buffer bytes.Buffer
+	for {
+		r, err := sc.Read()
+		if err != nil {
+			return buffer.String(), false
+		}
+		if r == '\n' {
+			return buffer.String(), true
+		}
+		buffer.WriteRune(r)
+	}
+}
+
+// StatefulManyParser repeats a parser while a condition on some
+// accumulated state holds.
+type StatefulManyParser struct {
+	inner Parser
+	init  interface{}
+	step  func(acc, val interface{}) (interface{}, bool)
+}
+
+// ManyWhileState returns a parser that matches the inner parser zero
+// or more times, threading a state through the matches. Starting from
+// init, step is called with the state and each result, and returns the
+// new state and whether to keep going. The match that makes step return
+// false isn't consumed, and its state is dropped. The result is the
+// final state.
+func ManyWhileState(inner Parser, init interface{}, step func(acc, val interface{}) (interface{}, bool)) Parser {
+	return &StatefulManyParser{inner: inner, init: init, step: step}
+}
+
+// Parse parses the input.
+func (p *StatefulManyParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	acc := p.init
+
+	for {
+		before := sc.GetPos()
+		sc.StartSnapshot()
+		r := p.inner.Parse(sc)
+		if !r.Matched() || sc.GetPos() == before {
+			sc.RewindSnapshot()
+			break
+		}
+
+		next, ok := p.step(acc, r.Result())
+		if !ok {
+			sc.RewindSnapshot()
+			break
+		}
+		sc.PopSnapshot()
+		acc = next
+	}
+
+	return result.Success(textpos.Range(start, sc.GetPos()), acc)
+}
+
+// Measured is the result of DisplayWidth.
+type Measured struct {
+	Value interface{}
+	Width int // the number of terminal columns the matched text takes
+}
+
+// wideRunes are the East Asian wide and fullwidth runes, which take two
+// columns in a terminal.
+var wideRunes = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x1100, Hi: 0x115f, Stride: 1},
+		{Lo: 0x2e80, Hi: 0x303e, Stride: 1},
+		{Lo: 0x3041, Hi: 0x33ff, Stride: 1},
+		{Lo: 0x3400, Hi: 0x4dbf, Stride: 1},
+		{Lo: 0x4e00, Hi: 0x9fff, Stride: 1},
+		{Lo: 0xa000, Hi: 0xa4cf, Stride: 1},
+		{Lo: 0xac00, Hi: 0xd7a3, Stride: 1},
+		{Lo: 0xf900, Hi: 0xfaff, Stride: 1},
+		{Lo: 0xfe30, Hi: 0xfe4f, Stride: 1},
+		{Lo: 0xff00, Hi: 0xff60, Stride: 1},
+		{Lo: 0xffe0, Hi: 0xffe6, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1f300, Hi: 0x1f64f, Stride: 1},
+		{Lo: 0x1f900, Hi: 0x1f9ff, Stride: 1},
+		{Lo: 0x20000, Hi: 0x2fffd, Stride: 1},
+		{Lo: 0x30000, Hi: 0x3fffd, Stride: 1},
+	},
+}
+
+// runeWidth returns the number of columns a rune takes in a terminal.
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case unicode.Is(wideRunes, r):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// WidthParser measures the text matched by a parser.
+type WidthParser struct {
+	inner Parser
+}
+
+// DisplayWidth returns a parser that runs the inner parser, and
+// returns a Measured value holding the inner result along with the
+// width of the matched text in a terminal. Wide characters (such as
+// CJK) count as two columns, and combining marks as zero.
+func DisplayWidth(inner Parser) Parser {
+	return &WidthParser{inner}
+}
+
+// Parse parses the input.
+func (p *WidthParser) Parse(sc scanner.Scanner) result.ParseResult {
+	r, text := parseRecorded(p.inner, sc)
+	if !r.Matched() {
+		return r
+	}
+	width := 0
+	for _, c := range text {
+		width += runeWidth(c)
+	}
+	return result.Success(r.TextRange(), Measured{Value: r.Result(), Width: width})
+}
+
+// TemplateSegment is a part of a template parsed by Template: either
+// literal text, or the name of a placeholder.
+type TemplateSegment struct {
+	Text        string
+	Placeholder bool
+}
+
+// Placeholders returns the names of the placeholders in the segments,
+// in order.
+func Placeholders(segments []TemplateSegment) []string {
+	names := []string{}
+	for _, segment := range segments {
+		if segment.Placeholder {
+			names = append(names, segment.Text)
+		}
+	}
+	return names
+}
+
+// TemplateParser parses text with placeholders.
+type TemplateParser struct {
+	open, close rune
+}
+
+// Template returns a parser for the rest of the input as a template
+// like "Hello {name}", where placeholder names appear between the open
+// and close runes. A doubled open or close rune (e.g. "{{") stands for
+// that rune in the literal text. The result is a []TemplateSegment.
+func Template(open, close rune) Parser {
+	return &TemplateParser{open: open, close: close}
+}
+
+// Parse parses the input.
+func (p *TemplateParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	segments := []TemplateSegment{}
+	var literal bytes.Buffer
+
+	for {
+		r, err := sc.Read()
+		if err != nil {
+			break
+		}
+		if (r == p.open || r == p.close) && p.readRune(sc, r) {
+			// A doubled rune is an escape
+			literal.WriteRune(r)
+			continue
+		}
+		if r != p.open {
+			literal.WriteRune(r)
+			continue
+		}
+
+		if literal.Len() > 0 {
+			segments = append(segments, TemplateSegment{Text: literal.String()})
+			literal.Reset()
+		}
+		name, err := p.readPlaceholder(sc)
+		if err != nil {
+			return result.Failed(textpos.Single(sc.GetPos()), err)
+		}
+		segments = append(segments, TemplateSegment{Text: name, Placeholder: true})
+	}
+
+	if literal.Len() > 0 {
+		segments = append(segments, TemplateSegment{Text: literal.String()})
+	}
+	return result.Success(textpos.Range(start, sc.GetPos()), segments)
+}
+
+// readRune consumes the next rune if it is the expected one.
+func (p *TemplateParser) readRune(sc scanner.Scanner, expected rune) bool {
+	sc.StartSnapshot()
+	r, err := sc.Read()
+	if err != nil || r != expected {
+		sc.RewindSnapshot()
+		return false
+	}
+	sc.PopSnapshot()
+	return true
+}
+
+// readPlaceholder reads the name of a placeholder and the close rune
+// after it.
+func (p *TemplateParser) readPlaceholder(sc scanner.Scanner) (string, error) {
+	var name bytes.Buffer
+	for {
+		r, err := sc.Read()
+		if err != nil {
+			return "", errors.New("unterminated placeholder")
+		}
+		if r == p.close {
+			break
+		}
+		if r == p.open {
+			return "", fmt.Errorf("unexpected '%c' in placeholder", r)
+		}
+		name.WriteRune(r)
+	}
+	if name.Len() == 0 {
+		return "", errors.New("empty placeholder")
+	}
+	return name.String(), nil
+}
+
+// openRune records an open bracket or quote seen by ValidateBalanced.
+type openRune struct {
+	r, close rune
+	pos      textpos.TextPos
+}
+
+// BalanceParser checks that brackets and quotes are balanced.
+type BalanceParser struct {
+	closers map[rune]rune // open rune -> close rune
+	openers map[rune]rune // close rune -> open rune
+}
+
+// ValidateBalanced returns a parser that checks that the given pairs
+// of open and close runes (like '(' and ')') are balanced and properly
+// nested in the rest of the input, failing at the first imbalance. A
+// pair with the same open and close rune is treated as a quote, and
+// other pairs are ignored between quotes. It doesn't consume any input,
+// so it can be run before parsing the input in detail.
+func ValidateBalanced(pairs [][2]rune) Parser {
+	p := &BalanceParser{closers: map[rune]rune{}, openers: map[rune]rune{}}
+	for _, pair := range pairs {
+		p.closers[pair[0]] = pair[1]
+		p.openers[pair[1]] = pair[0]
+	}
+	return p
+}
+
+// Parse parses the input.
+func (p *BalanceParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	sc.StartSnapshot()
+	defer sc.RewindSnapshot()
+
+	stack := []openRune{}
+	for {
+		pos := sc.GetPos()
+		r, err := sc.Read()
+		if err != nil {
+			break
+		}
+
+		var top *openRune
+		if len(stack) > 0 {
+			top = &stack[len(stack)-1]
+		}
+		inQuote := top != nil && top.r == top.close
+
+		switch {
+		case top != nil && r == top.close:
+			stack = stack[:len(stack)-1]
+		case inQuote:
+			// Everything else is ignored inside quotes
+		case p.closers[r] != 0:
+			stack = append(stack, openRune{r: r, close: p.closers[r], pos: pos})
+		case p.openers[r] != 0:
+			if top == nil {
+				return fail(pos, "unexpected '%c' with nothing to close", r)
+			}
+			return fail(pos, "expected '%c' to close '%c', got '%c'", top.close, top.r, r)
+		}
+	}
+
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return fail(top.pos, "unclosed '%c'", top.r)
+	}
+	return result.Success(textpos.Single(start), "")
+}
+
+// sentinelScanner makes the input appear to end where a sentinel string
+// starts.
+type sentinelScanner struct {
+	scanner.Scanner
+	sentinel []rune
+}
+
+// Unwrap returns the underlying scanner.
+func (s *sentinelScanner) Unwrap() scanner.Scanner {
+	return s.Scanner
+}
+
+// Read reads a rune, or returns an EOFError if the sentinel is next.
+func (s *sentinelScanner) Read() (rune, error) {
+	if s.atSentinel() {
+		return 0, &scanner.EOFError{}
+	}
+	return s.Scanner.Read()
+}
+
+// atSentinel returns whether the sentinel comes next in the input,
+// without consuming anything.
+func (s *sentinelScanner) atSentinel() bool {
+	s.Scanner.StartSnapshot()
+	defer s.Scanner.RewindSnapshot()
+	for _, expected := range s.sentinel {
+		r, err := s.Scanner.Read()
+		if err != nil || r != expected {
+			return false
+		}
+	}
+	return true
+}
+
+// SentinelParser runs a parser on the input up to a sentinel.
+type SentinelParser struct {
+	sentinel []rune
+	inner    Parser
+}
+
+// UntilSentinel returns a parser that runs the inner parser as if the
+// input ended where the sentinel string first appears, so e.g. a
+// ListOf parser returns the items before the sentinel. The sentinel
+// itself isn't consumed.
+func UntilSentinel(sentinel string, inner Parser) Parser {
+	if sentinel == "" {
+		panic("parser: UntilSentinel needs a non-empty sentinel")
+	}
+	return &SentinelParser{sentinel: []rune(sentinel), inner: inner}
+}
+
+// Parse parses the input.
+func (p *SentinelParser) Parse(sc scanner.Scanner) result.ParseResult {
+	return p.inner.Parse(&sentinelScanner{Scanner: sc, sentinel: p.sentinel})
+}
+
+// Partial is the result of BestEffort.
+type Partial struct {
+	Value interface{}
+	Err   error // nil if the whole parse succeeded
+}
+
+// BestEffortParser keeps the partial result of a failed parse.
+type BestEffortParser struct {
+	inner Parser
+}
+
+// BestEffort returns a parser that runs the inner parser, and if it
+// fails, succeeds anyway with whatever it had parsed before reaching the
+// failure. The result is a Partial value holding the inner result and
+// the error. The partial result is found by running the inner parser
+// again, looking into the parser that failed: for a Sequence or Map
+// that fails on its third item, the value holds the results of the
+// first two items, plus the partial result of the third if it was
+// itself one of these. For Or, it is the partial result of the
+// alternative that got the furthest. Label and Lazy are looked
+// through, and other parsers have no partial result.
+func BestEffort(inner Parser) Parser {
+	return &BestEffortParser{inner}
+}
+
+// Parse parses the input.
+func (p *BestEffortParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	sc.StartSnapshot()
+	r := p.inner.Parse(sc)
+	if r.Matched() {
+		sc.PopSnapshot()
+		return result.Success(r.TextRange(), Partial{Value: r.Result()})
+	}
+
+	end := sc.GetPos()
+	offset := offsetOf(sc)
+	sc.RewindSnapshot()
+	sc.StartSnapshot()
+	value := partialOf(p.inner, sc)
+	sc.RewindSnapshot()
+	skipTo(sc, offset, end)
+	return result.Success(
+		textpos.Range(start, end),
+		Partial{Value: value, Err: r.Error()})
+}
+
+// partialOf runs a parser that is known to fail, and returns the
+// results it got before failing, or nil if it has none. The scanner is
+// left wherever the parser stopped.
+func partialOf(p Parser, sc scanner.Scanner) interface{} {
+	switch p := p.(type) {
+	case *SeqParser:
+		return partialOfItems(p.parsers, sc)
+	case *MapParser:
+		items := make([]Parser, len(p.parsers))
+		for i, named := range p.parsers {
+			items[i] = named.Parser
+		}
+		return partialOfItems(items, sc)
+	case *OrParser:
+		var failure result.ParseResult
+		var value interface{}
+		for _, alternative := range p.parsers {
+			sc.StartSnapshot()
+			r := alternative.Parse(sc)
+			sc.RewindSnapshot()
+			if r.Matched() || (failure != nil && !failure.TextRange().End().Before(r.TextRange().End())) {
+				continue
+			}
+			failure = r
+			sc.StartSnapshot()
+			value = partialOf(alternative, sc)
+			sc.RewindSnapshot()
+		}
+		return value
+	case *LabelParser:
+		return partialOf(p.inner, sc)
+	case *LazyFn:
+		return partialOf(p.fn(), sc)
+	}
+	return nil
+}
+
+// partialOfItems runs parsers in series until one fails, returning the
+// results before it, plus its own partial result if it has one.
+func partialOfItems(parsers []Parser, sc scanner.Scanner) interface{} {
+	results := []interface{}{}
+	for _, inner := range parsers {
+		sc.StartSnapshot()
+		r := inner.Parse(sc)
+		if r.Matched() {
+			sc.PopSnapshot()
+			results = append(results, r.Result())
+			continue
+		}
+		sc.RewindSnapshot()
+		if nested := partialOf(inner, sc); nested != nil {
+			results = append(results, nested)
+		}
+		break
+	}
+	return cleanupResult(results)
+}
+
+// maxRegexRunes limits how far ahead Regex looks for a match.
+const maxRegexRunes = 1024
+
+// RegexParser matches a regular expression.
+type RegexParser struct {
+	re *regexp.Regexp
+}
+
+// Regex returns a parser that matches the longest text at the current
+// position that the regular expression matches, returning it as a
+// string. It panics if the pattern doesn't compile.
+//
+// Since the scanner reads one rune at a time, each attempt reads up to
+// 1024 runes ahead into a buffer, runs the expression over it, and then
+// rewinds to the end of the match. This makes Regex much slower than
+// the equivalent combinators for short tokens, and it can't match more
+// than 1024 runes. A "$" in the pattern matches at the end of the
+// buffer, which is not always the end of the input.
+func Regex(pattern string) Parser {
+	re := regexp.MustCompile(`^(?:` + pattern + `)`)
+	re.Longest()
+	return &RegexParser{re}
+}
+
+// Parse parses the input.
+func (p *RegexParser) Parse(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+
+	sc.StartSnapshot()
+	var buffer []rune
+	for len(buffer) < maxRegexRunes {
+		r, err := sc.Read()
+		if err != nil {
+			break
+		}
+		buffer = append(buffer, r)
+	}
+	sc.RewindSnapshot()
+
+	text := string(buffer)
+	loc := p.re.FindStringIndex(text)
+	if loc == nil {
+		return fail(start, "expected text matching /%s/", p.pattern())
+	}
+
+	matched := []rune(text[:loc[1]])
+	for range matched {
+		sc.Read()
+	}
+	return result.Success(textpos.Range(start, sc.GetPos()), string(matched))
+}
+
+// pattern returns the pattern that was given to Regex.
+func (p *RegexParser) pattern() string {
+	s := p.re.String()
+	return s[len(`^(?:`) : len(s)-1]
+}
@@ -1,11 +1,18 @@
 package parser_test
 
 import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
 	"testing"
+	"unicode"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/jmikkola/parsego/parser"
+	"github.com/jmikkola/parsego/parser/scanner"
+	"github.com/jmikkola/parsego/parser/textpos"
 )
 
 func TestParseEOF(t *testing.T) {
@@ -16,6 +23,29 @@ func TestParseEOF(t *testing.T) {
 	assert.Error(t, err, "Expected an error")
 }
 
+func TestParseStringComplete(t *testing.T) {
+	result1, err1 := parser.ParseString(parser.Digits(), "123abc")
+	assert.NoError(t, err1, "Expected ParseString to allow leftover input")
+	assert.Equal(t, "123", result1)
+
+	_, err2 := parser.ParseStringComplete(parser.Digits(), "123abc")
+	assert.EqualError(t, err2, "unexpected input after the end at line 0, col 3")
+
+	result3, err3 := parser.ParseStringComplete(parser.ListOf(parser.Digit()), "123")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, []interface{}{"1", "2", "3"}, result3)
+
+	_, err4 := parser.ParseStringComplete(parser.Digits(), "abc")
+	assert.Error(t, err4, "Expected the parser's own error")
+
+	result5, err5 := parser.ParseScannerComplete(parser.Digits(), strings.NewReader("42"))
+	assert.NoError(t, err5, "Expected successful parse")
+	assert.Equal(t, "42", result5)
+
+	_, err6 := parser.ParseScannerComplete(parser.Digits(), strings.NewReader("42\n"))
+	assert.EqualError(t, err6, "unexpected input after the end at line 0, col 2")
+}
+
 func TestAnyChar(t *testing.T) {
 	result, err := parser.ParseString(parser.AnyChar('a', '\n', '☃'), "☃")
 	assert.NoError(t, err, "Expected successful parse")
@@ -89,6 +119,28 @@ func TestWrapper(t *testing.T) {
 	assert.Error(t, err2, "Expected error when string doesn't match")
 }
 
+func TestMapE(t *testing.T) {
+	percent := parser.MapE(parser.Digits(), func(digits interface{}) (interface{}, error) {
+		n, _ := strconv.Atoi(digits.(string))
+		if n > 100 {
+			return nil, fmt.Errorf("%d is not a percentage", n)
+		}
+		return n, nil
+	})
+	p := parser.Surround(parser.Token("cpu: "), percent, parser.Whitespace())
+
+	result, err := parser.ParseString(p, "cpu: 42")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, 42, result)
+
+	_, err2 := parser.ParseString(p, "cpu: 420")
+	assert.EqualError(t, err2, "420 is not a percentage at line 0, col 8")
+
+	result3, err3 := parser.ParseString(parser.Or(percent, parser.Digits()), "420")
+	assert.NoError(t, err3, "Expected the failure to allow backtracking")
+	assert.Equal(t, "420", result3)
+}
+
 func TestParseToken(t *testing.T) {
 	floatTok := parser.Token("float64")
 	result, err := parser.ParseString(floatTok, "float64")
@@ -102,6 +154,21 @@ func TestParseToken(t *testing.T) {
 	assert.Error(t, err2, "Expected error")
 }
 
+func TestTokenCI(t *testing.T) {
+	p := parser.TokenCI("select")
+
+	result1, err1 := parser.ParseString(p, "SeLeCt")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "SeLeCt", result1, "Expected the input's case to be kept")
+
+	result2, err2 := parser.ParseString(parser.TokenCI("straße"), "STRAßE")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "STRAßE", result2)
+
+	_, err3 := parser.ParseString(p, "SeLeXt")
+	assert.Error(t, err3, "Expected error when a character differs")
+}
+
 func TestMaybe(t *testing.T) {
 	p := parser.Sequence(parser.Maybe(parser.Char('a')), parser.Char('b'))
 
@@ -127,6 +194,13 @@ func TestOr(t *testing.T) {
 	assert.Error(t, err2, "Expected error when no options match")
 }
 
+func TestOrFurthestError(t *testing.T) {
+	p := parser.Or(parser.Token("foobar"), parser.Token("foobaz"))
+
+	_, err := parser.ParseString(p, "foobaq")
+	assert.EqualError(t, err, "expected 'foobar', got 'foobaq' at line 0, col 6")
+}
+
 func TestMany(t *testing.T) {
 	p := parser.Many(parser.Digit())
 
@@ -135,6 +209,35 @@ func TestMany(t *testing.T) {
 	assert.Equal(t, "1234", result)
 }
 
+func TestSkipMany(t *testing.T) {
+	comment := parser.Sequence(parser.Char('#'), parser.Many(parser.NoneOf('\n')), parser.Char('\n'))
+	skip := parser.SkipMany(parser.Or(parser.WhitespaceChar(), comment))
+	p := parser.Sequence(skip, parser.Digits())
+
+	result1, err1 := parser.ParseString(p, " # one\n\t# two\n 42")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "42", result1)
+
+	r := skip.Parse(scanner.FromString("  # x\n7"))
+	assert.True(t, r.Matched())
+	assert.Equal(t, "", r.Result())
+	assert.Equal(t, textpos.Range(textpos.Pos(0, 0), textpos.Pos(1, 0)), r.TextRange())
+
+	result2, err2 := parser.ParseString(parser.SkipMany(parser.Maybe(parser.Char('a'))), "bbb")
+	assert.NoError(t, err2, "Expected zero-width matches not to loop")
+	assert.Equal(t, "", result2)
+}
+
+func TestSkipMany1(t *testing.T) {
+	p := parser.Sequence(parser.SkipMany1(parser.Char(' ')), parser.Digits())
+
+	result, err := parser.ParseString(p, "   42")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "42", result)
+
+	expectFails(t, p, "42")
+}
+
 func TestListOf(t *testing.T) {
 	p := parser.ListOf(parser.Digit())
 
@@ -143,6 +246,20 @@ func TestListOf(t *testing.T) {
 	assert.Equal(t, []interface{}{"1", "2", "3", "4"}, result)
 }
 
+func TestManyZeroWidth(t *testing.T) {
+	result1, err1 := parser.ParseString(parser.Many(parser.Maybe(parser.Char('a'))), "bbb")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "", result1)
+
+	result2, err2 := parser.ParseString(parser.Many(parser.Whitespace()), "  x")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "  ", result2)
+
+	result3, err3 := parser.ParseString(parser.ListOf(parser.Maybe(parser.Char('a'))), "aab")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, []interface{}{"a", "a"}, result3)
+}
+
 func TestMap(t *testing.T) {
 	p := parser.Map([]parser.Named{
 		{"value", parser.Many(parser.Letter())},
@@ -158,6 +275,20 @@ func TestMap(t *testing.T) {
 	assert.Equal(t, []interface{}{"myVar", "123"}, result)
 }
 
+func TestLabel(t *testing.T) {
+	p := parser.Sequence(parser.Char('x'), parser.Label("identifier", parser.Many1(parser.Letter())))
+
+	result, err := parser.ParseString(p, "xabc")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "xabc", result)
+
+	_, err2 := parser.ParseString(p, "x1")
+	assert.EqualError(t, err2, "expected identifier at line 0, col 2")
+
+	_, err3 := parser.ParseString(parser.Label("a digit", parser.Digit()), "\nx")
+	assert.EqualError(t, err3, "expected a digit at line 1, col 0")
+}
+
 func TestIgnore(t *testing.T) {
 	p := parser.Sequence(
 		parser.Ignore(parser.Char('"')),
@@ -167,3 +298,1216 @@ func TestIgnore(t *testing.T) {
 	assert.NoError(t, err, "Expected successful parse")
 	assert.Equal(t, "some quoted string", result)
 }
+
+func TestEscapableField(t *testing.T) {
+	p := parser.EscapableField(',', '\\')
+
+	result1, err1 := parser.ParseString(p, `a\,b,c`)
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "a,b", result1)
+
+	result2, err2 := parser.ParseString(p, `a\\b,c`)
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, `a\b`, result2)
+
+	_, err3 := parser.ParseString(p, `ab\`)
+	assert.Error(t, err3, "Expected error for a trailing escape")
+}
+
+func TestRunesOf(t *testing.T) {
+	p := parser.RunesOf(parser.Many(parser.NoneOf(',')))
+	result, err := parser.ParseString(p, "a☃ü,b")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []rune{'a', '☃', 'ü'}, result)
+}
+
+func TestOrLimited(t *testing.T) {
+	p := parser.OrLimited(2,
+		parser.Token("int32"), parser.Token("int64"), parser.Token("float32"))
+
+	result1, err1 := parser.ParseString(p, "int64")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "int64", result1)
+
+	_, err2 := parser.ParseString(p, "float32")
+	assert.EqualError(t, err2,
+		"expected 'int32', got 'f' at line 0, col 1 (no parser matched in the first 2 alternatives)",
+		"Expected the furthest error, noting the limit")
+}
+
+func TestCommit(t *testing.T) {
+	condition := parser.Sequence(parser.Char('('), parser.Digits(), parser.Char(')'))
+	ifStatement := parser.Sequence(parser.Token("if "), parser.Commit(condition))
+	p := parser.Or(ifStatement, parser.Many1(parser.Letter()))
+
+	result1, err1 := parser.ParseString(p, "if (1)")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "if (1)", result1)
+
+	result2, err2 := parser.ParseString(p, "iffy")
+	assert.NoError(t, err2, "Expected the second alternative before the commit")
+	assert.Equal(t, "iffy", result2)
+
+	_, err3 := parser.ParseString(p, "if x")
+	assert.EqualError(t, err3, "expected a character in the range '(' to '(', got error x at line 0, col 4",
+		"Expected the committed failure instead of the other alternative")
+
+	// The commitment only stops the nearest Or
+	outer := parser.Or(p, parser.Token("if x"))
+	result4, err4 := parser.ParseString(outer, "if x")
+	assert.NoError(t, err4, "Expected the outer Or to keep trying")
+	assert.Equal(t, "if x", result4)
+}
+
+func TestNestedComment(t *testing.T) {
+	p := parser.NestedComment("/*", "*/")
+
+	result1, err1 := parser.ParseString(p, "/* a */ b */")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, parser.Comment{Text: "/* a */", Depth: 1}, result1)
+
+	result2, err2 := parser.ParseString(p, "/* a /* b /* c */ */ d */ e")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, parser.Comment{Text: "/* a /* b /* c */ */ d */", Depth: 3}, result2)
+
+	_, err3 := parser.ParseString(p, "/* a /* b */")
+	assert.Error(t, err3, "Expected error for an unterminated comment")
+}
+
+func TestWithChecksum(t *testing.T) {
+	mod10 := func(s string) bool {
+		sum := 0
+		for _, r := range s {
+			sum += int(r - '0')
+		}
+		return sum%10 == 0
+	}
+	p := parser.WithChecksum(parser.Digits(), mod10)
+
+	result, err := parser.ParseString(p, "1234")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "1234", result)
+
+	_, err2 := parser.ParseString(p, "1235")
+	assert.Error(t, err2, "Expected error when the checksum fails")
+	assert.Contains(t, err2.Error(), "invalid checksum")
+}
+
+func TestRoundTrip(t *testing.T) {
+	number := parser.ParseWith(parser.Digits(), func(digits interface{}) interface{} {
+		n, _ := strconv.Atoi(digits.(string))
+		return n
+	})
+	render := func(v interface{}) string {
+		return strconv.Itoa(v.(int))
+	}
+	p := parser.RoundTrip(number, render)
+
+	result, err := parser.ParseString(p, "42")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, 42, result)
+
+	_, err2 := parser.ParseString(p, "007")
+	assert.EqualError(t, err2, "round trip mismatch: parsed '007' but rendered '7' at line 0, col 3")
+}
+
+type serverConfig struct {
+	Name  string
+	Port  int
+	Debug bool
+}
+
+func TestAssignFields(t *testing.T) {
+	newParser := func(config *serverConfig) parser.Parser {
+		return parser.AssignFields(config,
+			parser.Many1(parser.Letter()),
+			parser.Surround(parser.Many(parser.Char(' ')), parser.Char('='), parser.Many(parser.Char(' '))),
+			parser.Many1(parser.NoneOf('\n')))
+	}
+
+	config := &serverConfig{}
+	result, err := parser.ParseString(newParser(config), "name = web\nport = 8080\ndebug = true")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, &serverConfig{Name: "web", Port: 8080, Debug: true}, result)
+
+	_, err2 := parser.ParseString(newParser(&serverConfig{}), "name = web\nhost = example.com")
+	assert.Error(t, err2, "Expected error for an unknown key")
+	assert.Contains(t, err2.Error(), "unknown key 'host'")
+
+	_, err3 := parser.ParseString(newParser(&serverConfig{}), "port = eighty")
+	assert.Error(t, err3, "Expected error for a value of the wrong type")
+
+	kept := &serverConfig{Name: "default", Port: 80}
+	_, err4 := parser.ParseString(newParser(kept), "port = 8080\nhost = example.com")
+	assert.Error(t, err4, "Expected error for an unknown key")
+	assert.Equal(t, &serverConfig{Name: "default", Port: 80}, kept, "Expected a failed parse to leave the target alone")
+
+	result5, err5 := parser.ParseString(newParser(kept), "port = 8080")
+	assert.NoError(t, err5, "Expected successful parse")
+	assert.Equal(t, &serverConfig{Name: "default", Port: 8080}, result5, "Expected unset fields to be kept")
+}
+
+func TestArgumentList(t *testing.T) {
+	p := parser.ArgumentListWith(parser.Digits())
+
+	result1, err1 := parser.ParseString(p, "(1, 2)")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, parser.Arguments{
+		Positional: []interface{}{"1", "2"},
+		Keyword:    map[string]interface{}{},
+	}, result1)
+
+	result2, err2 := parser.ParseString(p, "(x=3, y = 4)")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, parser.Arguments{
+		Positional: []interface{}{},
+		Keyword:    map[string]interface{}{"x": "3", "y": "4"},
+	}, result2)
+
+	result3, err3 := parser.ParseString(p, "( 1, 2, x=3, y=4 )")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, parser.Arguments{
+		Positional: []interface{}{"1", "2"},
+		Keyword:    map[string]interface{}{"x": "3", "y": "4"},
+	}, result3)
+
+	result4, err4 := parser.ParseString(p, "()")
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Equal(t, parser.Arguments{
+		Positional: []interface{}{},
+		Keyword:    map[string]interface{}{},
+	}, result4)
+
+	_, err5 := parser.ParseString(p, "(x=3, 1)")
+	assert.Error(t, err5, "Expected error for a positional argument after a keyword")
+	assert.Contains(t, err5.Error(), "positional argument after keyword argument")
+}
+
+func TestArgumentListDefaultValues(t *testing.T) {
+	result, err := parser.ParseString(parser.ArgumentList(), `(1, "a b", x=2.5, y=z)`)
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, parser.Arguments{
+		Positional: []interface{}{1.0, "a b"},
+		Keyword:    map[string]interface{}{"x": 2.5, "y": "z"},
+	}, result)
+}
+
+func TestSpanned(t *testing.T) {
+	p := parser.Spanned(parser.Surround(
+		parser.Sequence(parser.Char('('), parser.Whitespace()),
+		parser.Spanned(parser.Digits()),
+		parser.Sequence(parser.Whitespace(), parser.Char(')'))))
+
+	result, err := parser.ParseString(p, "(\n  42\n)")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, parser.SpannedValue{
+		Value: parser.SpannedValue{
+			Value: "42",
+			Span:  textpos.Range(textpos.Pos(1, 2), textpos.Pos(1, 4)),
+		},
+		Span: textpos.Range(textpos.Pos(0, 0), textpos.Pos(2, 1)),
+	}, result)
+}
+
+func TestWithSourceLine(t *testing.T) {
+	source := "first line\n  second = 2\r\nthird"
+	p := parser.ListOf(parser.Surround(
+		parser.Many(parser.AnyChar(' ', '\r', '\n')),
+		parser.WithSourceLine(source, parser.Many1(parser.AlphaNum())),
+		parser.Maybe(parser.Token(" = "))))
+
+	result, err := parser.ParseString(p, source)
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []interface{}{
+		parser.SourceLine{Value: "first", Line: "first line", LineNum: 0},
+		parser.SourceLine{Value: "line", Line: "first line", LineNum: 0},
+		parser.SourceLine{Value: "second", Line: "  second = 2", LineNum: 1},
+		parser.SourceLine{Value: "2", Line: "  second = 2", LineNum: 1},
+		parser.SourceLine{Value: "third", Line: "third", LineNum: 2},
+	}, result)
+}
+
+func TestManyTillAny(t *testing.T) {
+	p := parser.ManyTillAny(parser.Letter(), parser.Char(';'), parser.Token("\n"))
+
+	result1, err1 := parser.ParseString(p, "ab;cd")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, parser.Terminated{Items: []interface{}{"a", "b"}, TerminatorIndex: 0}, result1)
+
+	result2, err2 := parser.ParseString(p, "abc\n;")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, parser.Terminated{Items: []interface{}{"a", "b", "c"}, TerminatorIndex: 1}, result2)
+
+	_, err3 := parser.ParseString(p, "abc")
+	assert.Error(t, err3, "Expected error when no terminator is found")
+}
+
+func TestSkipErrors(t *testing.T) {
+	p := parser.ManySepBy(parser.SkipErrors(parser.Digits()), parser.Char(','))
+
+	result, err := parser.ParseString(p, "12,#34,56")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []interface{}{
+		parser.Recovered{Value: "12"},
+		parser.Recovered{Value: "34", Skipped: []textpos.TextPos{textpos.Pos(0, 3)}},
+		parser.Recovered{Value: "56"},
+	}, result)
+
+	_, err2 := parser.ParseString(parser.SkipErrors(parser.Digits()), "abc")
+	assert.Error(t, err2, "Expected error when the input never matches")
+}
+
+func TestBiMap(t *testing.T) {
+	p := parser.BiMap(
+		parser.PairOf(parser.Letter(), parser.Char('='), parser.Digits()),
+		parser.Char(','))
+
+	result, err := parser.ParseString(p, "a=1,b=2")
+	assert.NoError(t, err, "Expected successful parse")
+	b := result.(*parser.Bijection)
+	assert.Equal(t, 2, b.Len())
+	value, ok := b.Value("b")
+	assert.True(t, ok)
+	assert.Equal(t, "2", value)
+	key, ok := b.Key("1")
+	assert.True(t, ok)
+	assert.Equal(t, "a", key)
+
+	_, err2 := parser.ParseString(p, "a=1,b=1")
+	assert.Error(t, err2, "Expected error for a duplicate value")
+	assert.Contains(t, err2.Error(), "duplicate value '1' at line 0, col 7")
+}
+
+func TestMaxDepth(t *testing.T) {
+	var brackets parser.Parser
+	brackets = parser.MaxDepth(3, parser.Lazy(func() parser.Parser {
+		return parser.Or(
+			parser.Surround(parser.Char('['), brackets, parser.Char(']')),
+			parser.Digits())
+	}))
+
+	result, err := parser.ParseString(brackets, "[[1]]")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "1", result)
+
+	_, err2 := parser.ParseString(brackets, "[[[[1]]]]")
+	assert.Error(t, err2, "Expected error when the input is nested too deeply")
+
+	_, err3 := parser.ParseString(parser.MaxDepth(0, parser.Digits()), "1")
+	assert.Error(t, err3, "Expected error when the input is nested too deeply")
+	assert.Contains(t, err3.Error(), "maximum nesting depth exceeded")
+}
+
+func TestLineContinuations(t *testing.T) {
+	p := parser.Spanned(parser.LineContinuations(parser.Many1(parser.NoneOf('\n'))))
+
+	result, err := parser.ParseString(p, "CFLAGS = -O2 \\\n  -Wall\nnext")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, parser.SpannedValue{
+		Value: "CFLAGS = -O2   -Wall",
+		Span:  textpos.Range(textpos.Pos(0, 0), textpos.Pos(1, 7)),
+	}, result)
+}
+
+type call struct {
+	name string
+	arg  interface{}
+}
+
+func TestRestrict(t *testing.T) {
+	var expr parser.Parser
+	expr = parser.Lazy(func() parser.Parser {
+		callExpr := parser.Map([]parser.Named{
+			{"name", parser.Many1(parser.Letter())},
+			{"arg", parser.Surround(parser.Char('('), expr, parser.Char(')'))},
+		}, func(m map[string]interface{}) interface{} {
+			return call{m["name"].(string), m["arg"]}
+		})
+		return parser.Or(callExpr, parser.Digits())
+	})
+	noCalls := func(value interface{}) bool {
+		_, isCall := value.(call)
+		return !isCall
+	}
+	p := parser.Restrict(expr, noCalls)
+
+	result, err := parser.ParseString(p, "42")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "42", result)
+
+	_, err2 := parser.ParseString(p, "exec(42)")
+	assert.Error(t, err2, "Expected error for a disallowed construct")
+	assert.Contains(t, err2.Error(), "construct not allowed")
+}
+
+func TestManyCapped(t *testing.T) {
+	stop := parser.Sequence(parser.ManyCapped(parser.Digit(), 3, parser.OverflowStop), parser.Many(parser.Digit()))
+	result1, err1 := parser.ParseString(stop, "12345")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []interface{}{[]interface{}{"1", "2", "3"}, "45"}, result1)
+
+	errs := parser.ManyCapped(parser.Digit(), 3, parser.OverflowError)
+	result2, err2 := parser.ParseString(errs, "123x")
+	assert.NoError(t, err2, "Expected successful parse at the cap")
+	assert.Equal(t, []interface{}{"1", "2", "3"}, result2)
+
+	_, err3 := parser.ParseString(errs, "1234")
+	assert.Error(t, err3, "Expected error past the cap")
+	assert.Contains(t, err3.Error(), "more than 3 matches")
+}
+
+func TestWord(t *testing.T) {
+	p := parser.Sequence(parser.Token("a "), parser.Word("cat"), parser.Token(" sat"))
+	_, err := parser.ParseString(p, "a cat sat")
+	assert.NoError(t, err, "Expected successful parse")
+
+	result, err1 := parser.ParseString(parser.Word("cat"), "cat")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "cat", result)
+
+	_, err2 := parser.ParseString(parser.Word("cat"), "category")
+	assert.Error(t, err2, "Expected error when followed by a letter")
+
+	_, err3 := parser.ParseString(parser.Sequence(parser.Char('s'), parser.Word("cat")), "scat")
+	assert.Error(t, err3, "Expected error when preceded by a letter")
+}
+
+func TestEmbedded(t *testing.T) {
+	sum := parser.FoldSepBy(
+		parser.ParseWith(parser.Digits(), func(v interface{}) interface{} {
+			n := 0
+			for _, r := range v.(string) {
+				n = n*10 + int(r-'0')
+			}
+			return n
+		}),
+		parser.Sequence(parser.Whitespace(), parser.Char('+'), parser.Whitespace()),
+		func(left, right interface{}) interface{} {
+			return left.(int) + right.(int)
+		})
+	p := parser.Sequence(
+		parser.Token("total: "),
+		parser.Embedded(parser.Token("$("), parser.Char(')'), sum),
+		parser.Char('!'))
+
+	result, err := parser.ParseString(p, "total: $(1 + 22)!")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []interface{}{"total: ", 23, "!"}, result)
+
+	_, err2 := parser.ParseString(p, "total: $(1 + x)!")
+	assert.Error(t, err2, "Expected error from the embedded parser")
+	assert.Contains(t, err2.Error(), "line 0, col 11")
+}
+
+func TestColumn(t *testing.T) {
+	row := parser.Sequence(
+		parser.Column(0, 6, parser.Many1(parser.Letter())),
+		parser.Column(6, 4, parser.Digits()))
+
+	result, err := parser.ParseString(row, "apple 12  ")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "apple12", result)
+
+	result2, err2 := parser.ParseString(row, "kiwi  7")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "kiwi7", result2)
+
+	_, err3 := parser.ParseString(row, "kiwi 7")
+	assert.Error(t, err3, "Expected error for a misaligned column")
+
+	result4, err4 := parser.ParseString(parser.Column(0, 3, parser.Digits()), "12345")
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Equal(t, "123", result4, "Expected the inner parser to stop at the column width")
+
+	_, err5 := parser.ParseString(parser.Column(1, 3, parser.Digits()), "123")
+	assert.Error(t, err5, "Expected error when not starting at the column")
+}
+
+func TestClassify(t *testing.T) {
+	p := parser.ListOf(parser.Classify([]parser.Category{
+		{Pred: unicode.IsDigit, Tag: "digit"},
+		{Pred: unicode.IsLetter, Tag: "letter"},
+		{Pred: unicode.IsPunct, Tag: "punct"},
+	}))
+
+	result, err := parser.ParseString(p, "a1!")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []interface{}{
+		parser.Classified{Rune: 'a', Tag: "letter"},
+		parser.Classified{Rune: '1', Tag: "digit"},
+		parser.Classified{Rune: '!', Tag: "punct"},
+	}, result)
+
+	_, err2 := parser.ParseString(parser.Classify([]parser.Category{
+		{Pred: unicode.IsDigit, Tag: "digit"},
+	}), "x")
+	assert.Error(t, err2, "Expected error when no category matches")
+}
+
+func TestCollectCaptures(t *testing.T) {
+	date := parser.Sequence(
+		parser.Named2("year", parser.Many1(parser.Digit())),
+		parser.Char('-'),
+		parser.Named2("month", parser.Digits()))
+	p := parser.CollectCaptures(parser.Sequence(
+		parser.Named2("name", parser.Many1(parser.Letter())),
+		parser.Char('@'),
+		parser.Or(
+			parser.Sequence(date, parser.Char('!')),
+			date)))
+
+	result, err := parser.ParseString(p, "release@2024-05")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, map[string]interface{}{
+		"name":  "release",
+		"year":  "2024",
+		"month": "05",
+	}, result)
+}
+
+type point struct {
+	x, y string
+}
+
+func TestBuild(t *testing.T) {
+	p := parser.Build(
+		func() interface{} { return &point{} },
+		parser.BuildStep{Parser: parser.Char('(')},
+		parser.BuildStep{Parser: parser.Digits(), Apply: func(acc, val interface{}) {
+			acc.(*point).x = val.(string)
+		}},
+		parser.BuildStep{Parser: parser.Char(',')},
+		parser.BuildStep{Parser: parser.Digits(), Apply: func(acc, val interface{}) {
+			acc.(*point).y = val.(string)
+		}},
+		parser.BuildStep{Parser: parser.Char(')')})
+
+	result, err := parser.ParseString(p, "(3,14)")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, &point{"3", "14"}, result)
+
+	_, err2 := parser.ParseString(p, "(3,)")
+	assert.Error(t, err2, "Expected error when a step fails")
+}
+
+func TestMaybePresent(t *testing.T) {
+	result1, err1 := parser.ParseString(parser.MaybePresent(parser.Digits()), "12")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, parser.Presence{Present: true, Value: "12"}, result1)
+
+	result2, err2 := parser.ParseString(parser.MaybePresent(parser.Many(parser.Digit())), "x")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, parser.Presence{Present: true, Value: ""}, result2)
+
+	result3, err3 := parser.ParseString(parser.MaybePresent(parser.Digits()), "x")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, parser.Presence{Present: false}, result3)
+}
+
+func TestMaybeRaw(t *testing.T) {
+	comment := parser.Ignore(parser.Sequence(parser.Token("//"), parser.Many(parser.NoneOf('\n'))))
+	p := parser.Map([]parser.Named{
+		{"", parser.Token("x = 1;")},
+		{"trivia", parser.MaybeRaw(parser.Sequence(parser.Whitespace1(), comment))},
+	}, func(m map[string]interface{}) interface{} {
+		return m["trivia"]
+	})
+
+	result1, err1 := parser.ParseString(p, "x = 1;  \t// keep  this")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, parser.RawPresence{Present: true, Raw: "  \t// keep  this"}, result1)
+
+	result2, err2 := parser.ParseString(p, "x = 1; y")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, parser.RawPresence{Present: false}, result2)
+
+	result3, err3 := parser.ParseString(parser.Sequence(parser.Ignore(p), parser.Token(" y")), "x = 1; y")
+	assert.NoError(t, err3, "Expected the failed attempt to be rewound")
+	assert.Equal(t, " y", result3)
+}
+
+func TestUniqueKeyMap(t *testing.T) {
+	p := parser.UniqueKeyMap(
+		parser.PairOf(parser.Many1(parser.Letter()), parser.Char(':'), parser.Digits()),
+		parser.Char(','),
+		func(pair interface{}) string {
+			return pair.(parser.Pair).Key.(string)
+		})
+
+	result, err := parser.ParseString(p, "a:1,b:2")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []interface{}{
+		parser.Pair{Key: "a", Value: "1"},
+		parser.Pair{Key: "b", Value: "2"},
+	}, result)
+
+	_, err2 := parser.ParseString(p, "a:1,b:2,a:3")
+	assert.Error(t, err2, "Expected error for a duplicate key")
+	assert.Contains(t, err2.Error(), "duplicate key 'a' at line 0, col 8")
+}
+
+func TestTokenBoundary(t *testing.T) {
+	p := parser.TokenBoundary("return")
+
+	result, err := parser.ParseString(p, "return x")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "return", result)
+
+	_, err2 := parser.ParseString(p, "return")
+	assert.NoError(t, err2, "Expected successful parse at EOF")
+
+	_, err3 := parser.ParseString(p, "returning")
+	assert.Error(t, err3, "Expected error when followed by a letter")
+
+	_, err4 := parser.ParseString(parser.Sequence(parser.Char('x'), p), "xreturn")
+	assert.NoError(t, err4, "Expected the start of the token not to be checked")
+}
+
+func TestTryEach(t *testing.T) {
+	p := parser.TryEach(parser.Digits(), parser.Char(','))
+
+	result, err := parser.ParseString(p, "12,x4,56,7y")
+	assert.NoError(t, err, "Expected successful parse")
+	batch := result.(parser.Batch)
+	assert.Equal(t, []interface{}{"12", "56"}, batch.Results)
+	assert.Equal(t, 2, len(batch.Errors))
+	assert.Contains(t, batch.Errors[0].Error(), "line 0, col 4")
+	assert.Contains(t, batch.Errors[1].Error(), "unexpected input after item")
+
+	result2, err2 := parser.ParseString(p, "")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, parser.Batch{Results: []interface{}{}}, result2)
+}
+
+func TestASCIIOnly(t *testing.T) {
+	p := parser.ASCIIOnly(parser.Many(parser.NoneOf('\n')))
+
+	result, err := parser.ParseString(p, "Content-Type: text/plain")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "Content-Type: text/plain", result)
+
+	_, err2 := parser.ParseString(p, "X-Name: Jürgen")
+	assert.EqualError(t, err2, "non-ASCII character 'ü' at line 0, col 9")
+}
+
+func TestOnError(t *testing.T) {
+	p := parser.Sequence(parser.Token("let "), parser.OnError(
+		parser.Many1(parser.Letter()),
+		func(found string, pos textpos.TextPos) string {
+			return fmt.Sprintf("variable names must start with a letter, not '%s' (col %d)", found, pos.Col())
+		}))
+
+	result, err := parser.ParseString(p, "let x")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "let x", result)
+
+	_, err2 := parser.ParseString(p, "let 9x")
+	assert.Error(t, err2, "Expected error")
+	assert.Contains(t, err2.Error(), "variable names must start with a letter, not '9' (col 4)")
+
+	_, err3 := parser.ParseString(p, "let ")
+	assert.Error(t, err3, "Expected error")
+	assert.Contains(t, err3.Error(), "not '' (col 4)")
+}
+
+func TestOptionalTrailing(t *testing.T) {
+	p := parser.Spanned(parser.OptionalTrailing(
+		parser.Many1(parser.Letter()),
+		parser.Sequence(parser.Char(';'), parser.Digits())))
+
+	result1, err1 := parser.ParseString(p, "msg;42")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, parser.SpannedValue{
+		Value: parser.WithTrailing{Main: "msg", Trailing: ";42", HasTrailing: true},
+		Span:  textpos.Range(textpos.Pos(0, 0), textpos.Pos(0, 6)),
+	}, result1)
+
+	result2, err2 := parser.ParseString(p, "msg;x")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, parser.SpannedValue{
+		Value: parser.WithTrailing{Main: "msg"},
+		Span:  textpos.Range(textpos.Pos(0, 0), textpos.Pos(0, 3)),
+	}, result2)
+}
+
+func TestHashed(t *testing.T) {
+	p := parser.ListOf(parser.Sequence(
+		parser.Hashed(parser.Many1(parser.NoneOf(';'))),
+		parser.Ignore(parser.Char(';'))))
+
+	result, err := parser.ParseString(p, "a = 1;b = 2;a = 1;")
+	assert.NoError(t, err, "Expected successful parse")
+	items := result.([]interface{})
+	first := items[0].([]interface{})[0].(parser.HashedValue)
+	second := items[1].([]interface{})[0].(parser.HashedValue)
+	third := items[2].([]interface{})[0].(parser.HashedValue)
+
+	assert.Equal(t, "a = 1", first.Value)
+	assert.Equal(t, first.Hash, third.Hash, "Expected identical text to hash the same")
+	assert.NotEqual(t, first.Hash, second.Hash, "Expected different text to hash differently")
+}
+
+func TestFactored(t *testing.T) {
+	commonRuns := 0
+	common := parser.Lazy(func() parser.Parser {
+		commonRuns++
+		return parser.Token("int")
+	})
+	p := parser.Factored(common, parser.Token("32"), parser.Token("64"))
+
+	result, err := parser.ParseString(p, "int64")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "int64", result)
+	assert.Equal(t, 1, commonRuns, "Expected the common prefix to be parsed once")
+
+	branches := parser.Factored(parser.Token("x = "),
+		parser.Sequence(parser.Char('['), parser.Digits(), parser.Char(']')),
+		parser.Digits())
+	_, err2 := parser.ParseString(branches, "x = [12)")
+	assert.Error(t, err2, "Expected error")
+	assert.Contains(t, err2.Error(), "range ']' to ']'")
+	assert.Contains(t, err2.Error(), "col 8")
+}
+
+func TestInDictionary(t *testing.T) {
+	colors := map[string]struct{}{"red": {}, "green": {}, "blue": {}}
+	p := parser.InDictionary(parser.Many1(parser.Letter()), colors)
+
+	result, err := parser.ParseString(p, "green")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "green", result)
+
+	_, err2 := parser.ParseString(p, "purple")
+	assert.Error(t, err2, "Expected error for a word not in the dictionary")
+	assert.Contains(t, err2.Error(), "unknown word 'purple'")
+}
+
+func TestTypedFields(t *testing.T) {
+	seconds := parser.ParseWith(
+		parser.Sequence(parser.Digits(), parser.Ignore(parser.Char('s'))),
+		func(v interface{}) interface{} {
+			n := 0
+			for _, r := range v.(string) {
+				n = n*10 + int(r-'0')
+			}
+			return n
+		})
+	schema := map[string]parser.Parser{
+		"timeout": seconds,
+		"name":    parser.Surround(parser.Char('"'), parser.Many(parser.NoneOf('"')), parser.Char('"')),
+		"enabled": parser.Or(parser.TokenAs("true", true), parser.TokenAs("false", false)),
+	}
+	p := parser.TypedFields(schema, parser.Char('='), parser.Sequence(parser.Char(','), parser.Whitespace()))
+
+	result, err := parser.ParseString(p, `timeout=5s, name="foo", enabled=true`)
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, map[string]interface{}{
+		"timeout": 5,
+		"name":    "foo",
+		"enabled": true,
+	}, result)
+
+	_, err2 := parser.ParseString(p, `name="foo", retries=3`)
+	assert.Error(t, err2, "Expected error for an unknown key")
+	assert.Contains(t, err2.Error(), "unknown key 'retries' at line 0, col 12")
+
+	_, err3 := parser.ParseString(p, `enabled=yes`)
+	assert.Error(t, err3, "Expected error for a badly typed value")
+}
+
+func TestConcatWith(t *testing.T) {
+	word := parser.Many1(parser.Letter())
+	space := parser.Ignore(parser.Whitespace())
+	p := parser.ConcatWith(" ", word, space, word, space, word)
+
+	result, err := parser.ParseString(p, "the   quick  fox")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "the quick fox", result)
+
+	withNumber := parser.ConcatWith(" ", word, parser.Char(':'), parser.Integer(), space, word)
+	result2, err2 := parser.ParseString(withNumber, "ab:12 cd")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{"ab :", 12, "cd"}, result2)
+}
+
+func TestTimes(t *testing.T) {
+	result1, err1 := parser.ParseString(parser.Sequence(parser.Times(0, parser.Digit()), parser.Char('x')), "x")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "x", result1)
+
+	result2, err2 := parser.ParseString(parser.Times(1, parser.Digit()), "12")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "1", result2)
+
+	result3, err3 := parser.ParseString(parser.Times(3, parser.Digit()), "1234")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, "123", result3)
+
+	result4, err4 := parser.ParseString(parser.Times(2, parser.SpacedNumber()), "1 2")
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Equal(t, []interface{}{1, 2}, result4)
+
+	p := parser.Or(parser.Times(4, parser.Digit()), parser.Many(parser.AnyCharIn("12x")))
+	result5, err5 := parser.ParseString(p, "12x")
+	assert.NoError(t, err5, "Expected the failed attempt to be rewound")
+	assert.Equal(t, "12x", result5)
+
+	_, err6 := parser.ParseString(parser.Times(4, parser.Digit()), "12x")
+	assert.EqualError(t, err6, "expected a character in the range '0' to '9', got error x at line 0, col 3")
+}
+
+func TestCountRange(t *testing.T) {
+	p := parser.CountRange(2, 4, parser.Digit())
+
+	_, err1 := parser.ParseString(p, "1")
+	assert.Error(t, err1, "Expected an error with too few matches")
+
+	result2, err2 := parser.ParseString(p, "12")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{"1", "2"}, result2)
+
+	result3, err3 := parser.ParseString(parser.Sequence(p, parser.Digit(), parser.EOF()), "12345")
+	assert.NoError(t, err3, "Expected the fifth digit to be left unconsumed")
+	assert.Equal(t, []interface{}{[]interface{}{"1", "2", "3", "4"}, "5", ""}, result3)
+
+	unbounded := parser.CountRange(0, -1, parser.Digit())
+	result4, err4 := parser.ParseString(unbounded, "123456789")
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Len(t, result4, 9)
+
+	result5, err5 := parser.ParseString(parser.Or(p, parser.Many(parser.AnyChar('1', 'x'))), "1x")
+	assert.NoError(t, err5, "Expected the failed attempt to be rewound")
+	assert.Equal(t, "1x", result5)
+}
+
+func TestRepetitionZeroWidth(t *testing.T) {
+	// Each of these would loop forever if it kept repeating a match
+	// that consumed nothing
+	optional := parser.Maybe(parser.Char('a'))
+	repetitions := map[string]parser.Parser{
+		"Many":           parser.Many(optional),
+		"ListOf":         parser.ListOf(optional),
+		"SkipMany":       parser.SkipMany(optional),
+		"ManyCapped":     parser.ManyCapped(optional, 5, parser.OverflowError),
+		"CountRange":     parser.CountRange(0, -1, optional),
+		"MemoizedMany":   parser.MemoizedMany(optional),
+		"ManySepBy":      parser.ManySepBy(optional, optional),
+		"ManyTillAny":    parser.ManyTillAny(optional, parser.Char('b')),
+		"ManyWhileState": parser.ManyWhileState(optional, 0, func(acc, _ interface{}) (interface{}, bool) { return acc, true }),
+		"TryEach":        parser.TryEach(optional, optional),
+		"UniqueKeyMap":   parser.UniqueKeyMap(optional, optional, func(interface{}) string { return "" }),
+	}
+	for name, p := range repetitions {
+		_, err := parser.ParseString(p, "b")
+		assert.NoError(t, err, "Expected %s to stop on a zero-width match", name)
+	}
+}
+
+func TestCountRangeZeroWidth(t *testing.T) {
+	optional := parser.Maybe(parser.Char('a'))
+
+	result1, err1 := parser.ParseString(parser.CountRange(0, -1, optional), "b")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []interface{}{""}, result1)
+
+	result2, err2 := parser.ParseString(parser.CountRange(3, -1, optional), "ab")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{"a", "", ""}, result2)
+}
+
+func TestAmbiguityCheck(t *testing.T) {
+	keyword := parser.Token("if")
+	name := parser.Many1(parser.Letter())
+	number := parser.Digits()
+
+	_, err1 := parser.ParseString(parser.AmbiguityCheck(number, keyword, name), "if")
+	assert.EqualError(t, err1, "ambiguous input: alternatives [1 2] all match at line 0, col 2")
+
+	result2, err2 := parser.ParseString(parser.AmbiguityCheck(number, keyword, name), "iffy")
+	assert.NoError(t, err2, "Expected matches of different lengths not to be ambiguous")
+	assert.Equal(t, "iffy", result2, "Expected the longest match")
+
+	_, err2b := parser.ParseString(parser.AmbiguityCheck(parser.Token("i"), keyword, name), "if")
+	assert.EqualError(t, err2b, "ambiguous input: alternatives [1 2] all match at line 0, col 2",
+		"Expected a shorter earlier match not to hide the ambiguity")
+
+	result3, err3 := parser.ParseString(parser.Sequence(parser.AmbiguityCheck(keyword, number), parser.EOF()), "42")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, "42", result3)
+
+	expectFails(t, parser.AmbiguityCheck(keyword, number), "x")
+
+	session := parser.NewSession("12")
+	session.CollectRuleStats()
+	result4, err4 := session.Parse(parser.AmbiguityCheck(keyword, parser.Rule("number", number)))
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Equal(t, "12", result4)
+	assert.Equal(t, 1, session.RuleStats()["number"].Calls, "Expected the match not to be parsed again")
+
+	tokens := []parser.LexedToken{tok("number", "1", 0), tok("op", "+", 2)}
+	overTokens := parser.Sequence(
+		parser.AmbiguityCheck(parser.MatchToken("number"), parser.MatchToken("op")),
+		parser.MatchToken("op"),
+		parser.EOF())
+	_, err5 := parser.ParseTokens(overTokens, tokens)
+	assert.NoError(t, err5, "Expected the match to be consumed from the tokens")
+	_, err6 := parser.ParseTokens(parser.CollectCaptures(overTokens), tokens)
+	assert.NoError(t, err6, "Expected the match to be consumed under a wrapping scanner")
+}
+
+func TestNot(t *testing.T) {
+	p := parser.Many1(parser.Sequence(parser.Not(parser.Token("end")), parser.Letter()))
+
+	result1, err1 := parser.ParseString(p, "abc")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "abc", result1)
+
+	result2, err2 := parser.ParseString(parser.Sequence(p, parser.Token("end")), "abend")
+	assert.NoError(t, err2, "Expected Not to stop the letters before \"end\"")
+	assert.Equal(t, "abend", result2)
+
+	_, err3 := parser.ParseString(parser.Sequence(parser.Not(parser.Token("end")), parser.Letter()), "end")
+	assert.EqualError(t, err3, "unexpected input at line 0, col 0")
+
+	result4, err4 := parser.ParseString(parser.Sequence(parser.Not(parser.Digit()), parser.Token("en")), "en")
+	assert.NoError(t, err4, "Expected Not to leave the input unconsumed")
+	assert.Equal(t, "en", result4)
+}
+
+func TestPeek(t *testing.T) {
+	name := parser.Many1(parser.Letter())
+	call := parser.Sequence(name, parser.Peek(parser.Char('(')))
+
+	result1, err1 := parser.ParseString(call, "f(x)")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "f", result1)
+
+	expectFails(t, call, "f x")
+
+	sc := scanner.FromString("ab")
+	r := parser.Peek(parser.Token("ab")).Parse(sc)
+	assert.True(t, r.Matched())
+	assert.Equal(t, "", r.Result())
+	assert.Equal(t, textpos.StartingPos(), sc.GetPos(), "Expected no input to be consumed")
+
+	r2 := parser.Peek(parser.Token("ax")).Parse(sc)
+	assert.False(t, r2.Matched())
+	assert.Equal(t, textpos.StartingPos(), sc.GetPos(), "Expected no input to be consumed")
+
+	nested := parser.Sequence(parser.Char('a'), parser.Peek(parser.Peek(parser.Char('b'))), parser.Char('b'))
+	result3, err3 := parser.ParseString(nested, "ab")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, "ab", result3, "Expected the lookahead not to add to the result")
+}
+
+func TestFraction(t *testing.T) {
+	p := parser.Fraction()
+	inputs := map[string]*big.Rat{
+		"3":       big.NewRat(3, 1),
+		"1/2":     big.NewRat(1, 2),
+		"6 / 4":   big.NewRat(3, 2),
+		"3 1/2":   big.NewRat(7, 2),
+		"-3  1/2": big.NewRat(-7, 2),
+		"+2/3":    big.NewRat(2, 3),
+		"2 cups":  big.NewRat(2, 1),
+	}
+	for input, expected := range inputs {
+		result, err := parser.ParseString(p, input)
+		assert.NoError(t, err, "Expected successful parse of %q", input)
+		assert.Equal(t, 0, expected.Cmp(result.(*big.Rat)), "Expected %v for %q, got %v", expected, input, result)
+	}
+
+	_, err := parser.ParseString(p, "3 1/0")
+	assert.EqualError(t, err, "division by zero in fraction at line 0, col 5")
+
+	expectFails(t, p, "/2")
+}
+
+func TestFencedBlock(t *testing.T) {
+	p := parser.FencedBlock("```")
+
+	result1, err1 := parser.ParseString(p, "```\n  indented\n\n\tline\n```")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, parser.Fenced{Content: "  indented\n\n\tline\n"}, result1)
+
+	result2, err2 := parser.ParseString(p, "``` go \nfmt.Println()\n```  \nafter")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, parser.Fenced{Info: "go", Content: "fmt.Println()\n"}, result2)
+
+	result3, err3 := parser.ParseString(p, "````md\n```\nnested\n```\n````\n")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, parser.Fenced{Info: "md", Content: "```\nnested\n```\n"}, result3)
+
+	result4, err4 := parser.ParseString(p, "```\n``` not a fence\n```")
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Equal(t, parser.Fenced{Content: "``` not a fence\n"}, result4)
+
+	_, err5 := parser.ParseString(p, "```\nunterminated\n")
+	assert.EqualError(t, err5, "unterminated fenced block at line 2, col 0")
+
+	expectFails(t, p, "``\ncode\n``")
+}
+
+func TestManyWhileState(t *testing.T) {
+	budget := func(acc, val interface{}) (interface{}, bool) {
+		sum := acc.(int) + val.(int)
+		return sum, sum <= 10
+	}
+	p := parser.Map([]parser.Named{
+		{"sum", parser.ManyWhileState(parser.SpacedNumber(), 0, budget)},
+		{"rest", parser.Many(parser.AnyCharIn("0123456789 "))},
+	}, func(m map[string]interface{}) interface{} {
+		return []interface{}{m["sum"], m["rest"]}
+	})
+
+	result1, err1 := parser.ParseString(p, "3 4 2 5 1")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []interface{}{9, "5 1"}, result1, "Expected to stop before the sum exceeds 10")
+
+	result2, err2 := parser.ParseString(p, "1 2")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{3, ""}, result2)
+
+	result3, err3 := parser.ParseString(p, "11")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, []interface{}{0, "11"}, result3)
+}
+
+func TestSatisfy(t *testing.T) {
+	vowel := parser.Satisfy(func(r rune) bool {
+		return strings.ContainsRune("aeiou", r)
+	})
+
+	result, err := parser.ParseString(parser.Many1(vowel), "eaux")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "eau", result)
+
+	_, err2 := parser.ParseString(vowel, "x")
+	assert.EqualError(t, err2, "unexpected character 'x' at line 0, col 1")
+
+	_, err3 := parser.ParseString(vowel, "")
+	assert.EqualError(t, err3, "expected a character, got error Reached end of input at line 0, col 0")
+
+	expectParses(t, parser.Satisfy(unicode.IsSpace), " ")
+}
+
+func TestDisplayWidth(t *testing.T) {
+	p := parser.DisplayWidth(parser.Many(parser.NoneOf('|')))
+
+	result1, err1 := parser.ParseString(p, "abc|")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, parser.Measured{Value: "abc", Width: 3}, result1)
+
+	result2, err2 := parser.ParseString(p, "日本語 ok")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, 9, result2.(parser.Measured).Width)
+
+	result3, err3 := parser.ParseString(p, "e\u0301te")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, 3, result3.(parser.Measured).Width, "Expected the combining accent to take no space")
+
+	expectFails(t, parser.DisplayWidth(parser.Digits()), "x")
+}
+
+func TestTemplate(t *testing.T) {
+	p := parser.Template('{', '}')
+
+	result1, err1 := parser.ParseString(p, "Hello {name}, you have {count} messages")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []parser.TemplateSegment{
+		{Text: "Hello "},
+		{Text: "name", Placeholder: true},
+		{Text: ", you have "},
+		{Text: "count", Placeholder: true},
+		{Text: " messages"},
+	}, result1)
+	assert.Equal(t, []string{"name", "count"}, parser.Placeholders(result1.([]parser.TemplateSegment)))
+
+	result2, err2 := parser.ParseString(p, "{{literal}} and {x}{y}")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []parser.TemplateSegment{
+		{Text: "{literal} and "},
+		{Text: "x", Placeholder: true},
+		{Text: "y", Placeholder: true},
+	}, result2)
+
+	result3, err3 := parser.ParseString(p, "")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, []parser.TemplateSegment{}, result3)
+
+	_, err4 := parser.ParseString(p, "Hi {name")
+	assert.EqualError(t, err4, "unterminated placeholder at line 0, col 8")
+
+	expectFails(t, p, "Hi {}")
+	expectFails(t, p, "Hi {a{b}")
+}
+
+func TestValidateBalanced(t *testing.T) {
+	p := parser.ValidateBalanced([][2]rune{{'(', ')'}, {'[', ']'}, {'"', '"'}})
+
+	result, err := parser.ParseString(parser.Sequence(p, parser.Token("f(a[1], \"(\")")), "f(a[1], \"(\")")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "f(a[1], \"(\")", result, "Expected the input to be left for the next parser")
+
+	_, err2 := parser.ParseString(p, "f(a[1]")
+	assert.EqualError(t, err2, "unclosed '(' at line 0, col 1")
+
+	_, err3 := parser.ParseString(p, "a)\n(b)")
+	assert.EqualError(t, err3, "unexpected ')' with nothing to close at line 0, col 1")
+
+	_, err4 := parser.ParseString(p, "(a[1)]")
+	assert.EqualError(t, err4, "expected ']' to close '[', got ')' at line 0, col 4")
+
+	_, err5 := parser.ParseString(p, "(\"a)")
+	assert.EqualError(t, err5, "unclosed '\"' at line 0, col 1")
+}
+
+func TestUntilSentinel(t *testing.T) {
+	item := parser.Surround(parser.Whitespace(), parser.Digits(), parser.Whitespace())
+	p := parser.Map([]parser.Named{
+		{"items", parser.UntilSentinel("END", parser.ListOf(item))},
+		{"", parser.Token("END")},
+	}, func(m map[string]interface{}) interface{} {
+		return m["items"]
+	})
+
+	result1, err1 := parser.ParseString(p, "1 2 3 END 4 5")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []interface{}{"1", "2", "3"}, result1)
+
+	result2, err2 := parser.ParseString(p, "END")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{}, result2)
+
+	result3, err3 := parser.ParseString(parser.UntilSentinel("END", parser.Many(parser.AnyChar('E', 'N', 'x'))), "xENxEND")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, "xENx", result3, "Expected a partial sentinel not to stop parsing")
+
+	expectFails(t, parser.UntilSentinel(";", parser.Token("a;b")), "a;b")
+}
+
+func TestBestEffort(t *testing.T) {
+	pair := parser.Sequence(parser.Letter(), parser.Char('='), parser.Digit())
+	p := parser.BestEffort(parser.Sequence(parser.Char('('), pair, parser.Char(')')))
+
+	result, err := parser.ParseString(p, "(a=5)")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, parser.Partial{Value: "(a=5)"}, result)
+
+	result2, err2 := parser.ParseString(p, "(a=x)")
+	assert.NoError(t, err2, "Expected successful parse")
+	partial := result2.(parser.Partial)
+	assert.Equal(t, "(a=", partial.Value)
+	assert.EqualError(t, partial.Err, "expected a character in the range '0' to '9', got error x at line 0, col 4")
+
+	withList := parser.BestEffort(parser.Sequence(parser.ListOf(parser.Digit()), parser.Char(';')))
+	result3, err3 := parser.ParseString(withList, "12x")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, []interface{}{[]interface{}{"1", "2"}}, result3.(parser.Partial).Value)
+	assert.Error(t, result3.(parser.Partial).Err)
+}
+
+func TestBestEffortThroughWrappers(t *testing.T) {
+	pair := parser.Sequence(parser.Letter(), parser.Char('='), parser.Digit())
+
+	labeled := parser.BestEffort(parser.Label("pair", parser.Sequence(parser.Char('('), pair, parser.Char(')'))))
+	result1, err1 := parser.ParseString(labeled, "(a=x)")
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, "(a=", result1.(parser.Partial).Value)
+	assert.EqualError(t, result1.(parser.Partial).Err, "expected pair at line 0, col 4")
+
+	mapped := parser.BestEffort(parser.Map([]parser.Named{
+		{"", parser.Char('(')},
+		{"pair", pair},
+		{"", parser.Char(')')},
+	}, func(m map[string]interface{}) interface{} {
+		return m["pair"]
+	}))
+	result2, err2 := parser.ParseString(mapped, "(a=x)")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "(a=", result2.(parser.Partial).Value)
+
+	colon := parser.Sequence(parser.Letter(), parser.Char(':'))
+	alternatives := parser.BestEffort(parser.Sequence(parser.Char('('), parser.Or(colon, pair), parser.Char(')')))
+	result3, err3 := parser.ParseString(alternatives, "(a=x)")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, "(a=", result3.(parser.Partial).Value, "Expected the furthest alternative's partial result")
+
+	captured := parser.CollectCaptures(parser.Named2("p", parser.BestEffort(parser.Sequence(parser.Char('('), pair))))
+	result4, err4 := parser.ParseString(captured, "(a=x)")
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Equal(t, "(a=", result4.(map[string]interface{})["p"].(parser.Partial).Value,
+		"Expected partials under a scanner wrapper")
+
+	lazy := parser.BestEffort(parser.Lazy(func() parser.Parser { return parser.Sequence(parser.Char('('), pair) }))
+	result5, err5 := parser.ParseString(lazy, "(a=x)")
+	assert.NoError(t, err5, "Expected successful parse")
+	assert.Equal(t, "(a=", result5.(parser.Partial).Value)
+
+	sc := scanner.FromString("(a=x)")
+	r := lazy.Parse(sc)
+	assert.Equal(t, textpos.Range(textpos.Pos(0, 0), textpos.Pos(0, 4)), r.TextRange())
+	assert.Equal(t, textpos.Pos(0, 4), sc.GetPos(), "Expected the scanner to be left at the failure")
+}
+
+func TestTakeWhile(t *testing.T) {
+	p := parser.Sequence(parser.TakeWhile(unicode.IsDigit), parser.Ignore(parser.Token("abc")))
+	result, err := parser.ParseString(p, "123abc")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "123", result)
+
+	result2, err2 := parser.ParseString(parser.TakeWhile(unicode.IsDigit), "abc")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "", result2)
+
+	result3, err3 := parser.ParseString(parser.TakeWhile(unicode.IsDigit), "42")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, "42", result3)
+}
+
+func TestTakeWhile1(t *testing.T) {
+	result, err := parser.ParseString(parser.TakeWhile1(unicode.IsLetter), "ab1")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "ab", result)
+
+	_, err2 := parser.ParseString(parser.TakeWhile1(unicode.IsLetter), "1ab")
+	assert.EqualError(t, err2, "unexpected character '1' at line 0, col 1")
+
+	_, err3 := parser.ParseString(parser.TakeWhile1(unicode.IsLetter), "")
+	assert.Error(t, err3, "Expected an error")
+}
+
+func TestTakeUntil(t *testing.T) {
+	p := parser.TakeUntil(func(r rune) bool { return r == ';' })
+	result, err := parser.ParseString(parser.Sequence(p, parser.Ignore(parser.Char(';'))), "a b;")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "a b", result)
+
+	result2, err2 := parser.ParseString(p, ";")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "", result2)
+
+	result3, err3 := parser.ParseStringComplete(p, "no end")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, "no end", result3)
+}
+
+func TestRegex(t *testing.T) {
+	p := parser.Regex(`[0-9]+\.[0-9]+`)
+	result, err := parser.ParseString(parser.Sequence(p, parser.Ignore(parser.Char('x'))), "12.5x")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "12.5", result)
+
+	_, err2 := parser.ParseString(p, "x12.5")
+	assert.EqualError(t, err2, `expected text matching /[0-9]+\.[0-9]+/ at line 0, col 0`)
+
+	// The longest match wins, even if an earlier alternative matches
+	longest := parser.Regex(`a|ab|abc`)
+	result3, err3 := parser.ParseStringComplete(longest, "abc")
+	assert.NoError(t, err3, "Expected successful parse")
+	assert.Equal(t, "abc", result3)
+
+	result4, err4 := parser.ParseString(parser.Regex(`é+`), "ééa")
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Equal(t, "éé", result4)
+}
@@ -27,6 +27,21 @@ type Scanner interface {
 	PopSnapshot()
 }
 
+// LookBehind is implemented by scanners that can report the rune
+// before the current position.
+type LookBehind interface {
+	// Previous returns the last rune read, or false at the start of
+	// the input.
+	Previous() (rune, bool)
+}
+
+// Seeker is implemented by scanners that can report and jump to an
+// absolute offset (counted in runes) in the input.
+type Seeker interface {
+	Offset() int
+	Seek(offset int)
+}
+
 // snapshot records the state of a snapshot taken by a scanner.
 type snapshot struct {
 	idx        int
@@ -38,15 +53,24 @@ type snapshot struct {
 type StringScanner struct {
 	rs         []rune
 	idx        int
+	origin     textpos.TextPos // the position of the first rune
 	currentPos textpos.TextPos
 	lastSnap   *snapshot
 }
 
 // FromString creates a Scanner from a string.
 func FromString(str string) Scanner {
+	return FromStringAt(str, textpos.StartingPos())
+}
+
+// FromStringAt creates a Scanner from a string that starts at the
+// given position of some larger input, so that positions are reported
+// relative to the larger input.
+func FromStringAt(str string, pos textpos.TextPos) Scanner {
 	return &StringScanner{
 		rs:         []rune(str),
-		currentPos: textpos.StartingPos(),
+		origin:     pos,
+		currentPos: pos,
 	}
 }
 
@@ -69,6 +93,39 @@ func (self *StringScanner) GetPos() textpos.TextPos {
 	return self.currentPos
 }
 
+// Previous returns the rune before the current position.
+func (self *StringScanner) Previous() (rune, bool) {
+	if self.idx == 0 {
+		return 0, false
+	}
+	return self.rs[self.idx-1], true
+}
+
+// Offset returns the number of runes read so far.
+func (self *StringScanner) Offset() int {
+	return self.idx
+}
+
+// Seek moves the scanner to the given offset, recomputing the
+// position from the scanner's starting position. Offsets past the end
+// of the input move to the end.
+func (self *StringScanner) Seek(offset int) {
+	if offset > len(self.rs) {
+		offset = len(self.rs)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset < self.idx {
+		self.idx = 0
+		self.currentPos = self.origin
+	}
+	for self.idx < offset {
+		self.currentPos = self.currentPos.Advance(self.rs[self.idx])
+		self.idx++
+	}
+}
+
 // StartSnapshot takes a new snapshot that can be rolled back to
 // later.
 func (self *StringScanner) StartSnapshot() {
@@ -98,3 +155,119 @@ func (s *StringScanner) PopSnapshot() {
 	}
 	s.lastSnap = s.lastSnap.next
 }
+
+// continuationScanner skips backslash-newline pairs in the underlying
+// scanner.
+type continuationScanner struct {
+	Scanner
+}
+
+// JoinContinuations wraps a scanner so that a backslash immediately
+// before a newline joins the two lines (both the backslash and the
+// newline are skipped). Positions still refer to the original input.
+func JoinContinuations(sc Scanner) Scanner {
+	return &continuationScanner{sc}
+}
+
+// Unwrap returns the underlying scanner.
+func (s *continuationScanner) Unwrap() Scanner {
+	return s.Scanner
+}
+
+// Read a rune, skipping any line continuations.
+func (s *continuationScanner) Read() (rune, error) {
+	for {
+		r, err := s.Scanner.Read()
+		if err != nil || r != '\\' {
+			return r, err
+		}
+
+		s.Scanner.StartSnapshot()
+		next, err := s.Scanner.Read()
+		if err != nil || next != '\n' {
+			s.Scanner.RewindSnapshot()
+			return r, nil
+		}
+		s.Scanner.PopSnapshot()
+	}
+}
+
+// transformScanner changes or drops runes read from the underlying
+// scanner. It tracks its own positions, since dropping or changing
+// runes (such as newlines) changes where later runes appear.
+type transformScanner struct {
+	inner      Scanner
+	transform  func(rune) rune
+	keep       func(rune) bool
+	currentPos textpos.TextPos
+	marks      []textpos.TextPos
+}
+
+// Map wraps a scanner so that each rune read is passed through the
+// transform function. Positions are those of the transformed text.
+func Map(sc Scanner, transform func(rune) rune) Scanner {
+	return &transformScanner{inner: sc, transform: transform, currentPos: sc.GetPos()}
+}
+
+// Filter wraps a scanner so that only the runes for which keep returns
+// true are read. Positions are those of the filtered text, i.e. as if
+// the dropped runes had never been there.
+func Filter(sc Scanner, keep func(rune) bool) Scanner {
+	return &transformScanner{inner: sc, keep: keep, currentPos: sc.GetPos()}
+}
+
+// Unwrap returns the underlying scanner.
+func (s *transformScanner) Unwrap() Scanner {
+	return s.inner
+}
+
+// Read reads the next rune that is kept, transformed.
+func (s *transformScanner) Read() (rune, error) {
+	for {
+		r, err := s.inner.Read()
+		if err != nil {
+			return r, err
+		}
+		if s.keep != nil && !s.keep(r) {
+			continue
+		}
+		if s.transform != nil {
+			r = s.transform(r)
+		}
+		s.currentPos = s.currentPos.Advance(r)
+		return r, nil
+	}
+}
+
+// GetPos returns the position in the transformed text.
+func (s *transformScanner) GetPos() textpos.TextPos {
+	return s.currentPos
+}
+
+// StartSnapshot takes a snapshot of the underlying scanner and the
+// current position.
+func (s *transformScanner) StartSnapshot() {
+	s.marks = append(s.marks, s.currentPos)
+	s.inner.StartSnapshot()
+}
+
+// RewindSnapshot rewinds the underlying scanner and the current
+// position.
+func (s *transformScanner) RewindSnapshot() {
+	if len(s.marks) == 0 {
+		panic("Bug: rewinding to a snapshot that was never started")
+	}
+	last := len(s.marks) - 1
+	s.currentPos = s.marks[last]
+	s.marks = s.marks[:last]
+	s.inner.RewindSnapshot()
+}
+
+// PopSnapshot drops the last snapshot.
+func (s *transformScanner) PopSnapshot() {
+	if len(s.marks) == 0 {
+		panic("Bug: popped a snapshot that was never started")
+	}
+	s.marks = s.marks[:len(s.marks)-1]
+	s.inner.PopSnapshot()
+}
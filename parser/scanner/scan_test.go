@@ -2,6 +2,7 @@ package scanner_test
 
 import (
 	"testing"
+	"unicode"
 
 	"github.com/stretchr/testify/assert"
 
@@ -165,3 +166,113 @@ func TestBug(t *testing.T) {
 	sc.StartSnapshot()
 	assertReads(t, sc, 'b')
 }
+
+func TestJoinContinuations(t *testing.T) {
+	sc := scanner.JoinContinuations(scanner.FromString("a\\\nb\\c\\"))
+	assertReads(t, sc, 'a')
+	assertReads(t, sc, 'b')
+	assert.Equal(t, textpos.Pos(1, 1), sc.GetPos())
+	assertReads(t, sc, '\\')
+	assertReads(t, sc, 'c')
+
+	sc.StartSnapshot()
+	assertReads(t, sc, '\\')
+	sc.RewindSnapshot()
+	assertReads(t, sc, '\\')
+
+	_, err := sc.Read()
+	assert.Error(t, err, "Expected EOF")
+}
+
+func TestPrevious(t *testing.T) {
+	sc := scanner.FromString("ab")
+	lb := sc.(scanner.LookBehind)
+
+	_, ok := lb.Previous()
+	assert.False(t, ok, "Expected no previous rune at the start")
+
+	assertReads(t, sc, 'a')
+	sc.StartSnapshot()
+	assertReads(t, sc, 'b')
+	r, ok := lb.Previous()
+	assert.True(t, ok)
+	assert.Equal(t, 'b', r)
+
+	sc.RewindSnapshot()
+	r, ok = lb.Previous()
+	assert.True(t, ok)
+	assert.Equal(t, 'a', r)
+}
+
+func TestFromStringAt(t *testing.T) {
+	sc := scanner.FromStringAt("a\nb", textpos.Pos(3, 7))
+	assert.Equal(t, textpos.Pos(3, 7), sc.GetPos())
+	assertReads(t, sc, 'a')
+	assertReads(t, sc, '\n')
+	assertReads(t, sc, 'b')
+	assert.Equal(t, textpos.Pos(4, 1), sc.GetPos())
+}
+
+func TestMapAndFilter(t *testing.T) {
+	noComments := func(r rune) bool { return r != '#' }
+	sc := scanner.Map(
+		scanner.Filter(scanner.FromString("A#b\n#C"), noComments),
+		unicode.ToLower)
+
+	assertReads(t, sc, 'a')
+	assert.Equal(t, textpos.Pos(0, 1), sc.GetPos())
+	assertReads(t, sc, 'b')
+	assert.Equal(t, textpos.Pos(0, 2), sc.GetPos())
+
+	sc.StartSnapshot()
+	assertReads(t, sc, '\n')
+	assertReads(t, sc, 'c')
+	assert.Equal(t, textpos.Pos(1, 1), sc.GetPos())
+	sc.RewindSnapshot()
+
+	assert.Equal(t, textpos.Pos(0, 2), sc.GetPos())
+	assertReads(t, sc, '\n')
+	assertReads(t, sc, 'c')
+
+	_, err := sc.Read()
+	assert.Error(t, err, "Expected EOF")
+}
+
+func TestSeek(t *testing.T) {
+	sc := scanner.FromString("ab\ncd")
+	seeker := sc.(scanner.Seeker)
+
+	seeker.Seek(4)
+	assert.Equal(t, 4, seeker.Offset())
+	assert.Equal(t, textpos.Pos(1, 1), sc.GetPos())
+	assertReads(t, sc, 'd')
+
+	seeker.Seek(1)
+	assert.Equal(t, textpos.Pos(0, 1), sc.GetPos())
+	assertReads(t, sc, 'b')
+
+	seeker.Seek(100)
+	assert.Equal(t, 5, seeker.Offset())
+	_, err := sc.Read()
+	assert.Error(t, err, "Expected EOF")
+
+	at := scanner.FromStringAt("ab\ncd", textpos.Pos(3, 2))
+	atSeeker := at.(scanner.Seeker)
+	atSeeker.Seek(4)
+	assert.Equal(t, textpos.Pos(4, 1), at.GetPos())
+	atSeeker.Seek(1)
+	assert.Equal(t, 1, atSeeker.Offset())
+	assert.Equal(t, textpos.Pos(3, 3), at.GetPos(), "Expected positions relative to the scanner's start")
+	assertReads(t, at, 'b')
+
+	// Seeking after rewinding part way back
+	at.StartSnapshot()
+	assertReads(t, at, '\n')
+	assertReads(t, at, 'c')
+	at.RewindSnapshot()
+	atSeeker.Seek(0)
+	assert.Equal(t, 0, atSeeker.Offset())
+	assert.Equal(t, textpos.Pos(3, 2), at.GetPos())
+	atSeeker.Seek(5)
+	assert.Equal(t, textpos.Pos(4, 2), at.GetPos())
+}
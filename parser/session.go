@@ -0,0 +1,370 @@
+package parser
+
+import (
+	"fmt"
+	"time"
+	"unicode"
+
+	"github.com/jmikkola/parsego/parser/result"
+	"github.com/jmikkola/parsego/parser/scanner"
+	"github.com/jmikkola/parsego/parser/textpos"
+)
+
+// Session holds the state shared by the parsers during a single parse
+// of some input, such as the memoized results of named rules.
+type Session struct {
+	scanner.Scanner
+	memo       map[memoKey]memoEntry
+	failures   map[failureKey]bool
+	stats      map[string]*RuleStat // nil unless stats are collected
+	ignoreCase bool
+}
+
+// memoKey identifies a rule applied at a position. Whether case was
+// ignored is part of the key, since it can change what the rule
+// matches.
+type memoKey struct {
+	rule       string
+	pos        textpos.TextPos
+	ignoreCase bool
+}
+
+// memoEntry records the result of applying a rule, and where the
+// scanner was left afterwards.
+type memoEntry struct {
+	result result.ParseResult
+	end    textpos.TextPos
+	offset int // only set if the scanner can seek
+}
+
+// failureKey identifies a parser that failed at a position. The
+// scanner it was given is part of the key, since a wrapping scanner
+// (like the one used by UntilSentinel) can change whether it fails.
+type failureKey struct {
+	parser  Parser
+	scanner scanner.Scanner
+	pos     textpos.TextPos
+}
+
+// NewSession starts a session for parsing the given string.
+func NewSession(str string) *Session {
+	return newSession(scanner.FromString(str))
+}
+
+func newSession(sc scanner.Scanner) *Session {
+	return &Session{
+		Scanner:  sc,
+		memo:     map[memoKey]memoEntry{},
+		failures: map[failureKey]bool{},
+	}
+}
+
+// Unwrap returns the underlying scanner.
+func (s *Session) Unwrap() scanner.Scanner {
+	return s.Scanner
+}
+
+// Parse runs the parser over the session's input.
+func (s *Session) Parse(p Parser) (interface{}, error) {
+	r := p.Parse(s)
+	return r.Result(), r.Error()
+}
+
+// Checkpoint records how far a session has parsed, so that parsing of
+// the same input can be resumed later, possibly in another session.
+type Checkpoint struct {
+	Offset int // the number of runes parsed
+}
+
+// findSeeker finds a scanner that supports offsets in a chain of
+// wrapped scanners, if there is one.
+func findSeeker(sc scanner.Scanner) scanner.Seeker {
+	seeker, _ := findScanner(sc, func(s scanner.Scanner) bool {
+		_, ok := s.(scanner.Seeker)
+		return ok
+	}).(scanner.Seeker)
+	return seeker
+}
+
+// seeker finds the scanner used for checkpoints.
+func (s *Session) seeker() scanner.Seeker {
+	seeker := findSeeker(s.Scanner)
+	if seeker == nil {
+		panic("parser: the session's scanner does not support checkpoints")
+	}
+	return seeker
+}
+
+// Checkpoint returns the current position of the session.
+func (s *Session) Checkpoint() Checkpoint {
+	return Checkpoint{Offset: s.seeker().Offset()}
+}
+
+// ResumeFrom moves the session to the position recorded in the
+// checkpoint, so that the next call to Parse continues from there.
+func (s *Session) ResumeFrom(c Checkpoint) {
+	s.seeker().Seek(c.Offset)
+}
+
+// RuleStat describes how a rule was used during a session.
+type RuleStat struct {
+	Calls    int           // the number of times the rule was tried
+	Duration time.Duration // time spent in the rule, including the rules it uses
+	Runes    int           // the number of runes consumed by successful calls
+}
+
+// CollectRuleStats makes the session record statistics about each
+// Rule used in later calls to Parse. It slows parsing down, so it is
+// meant for profiling grammars.
+func (s *Session) CollectRuleStats() {
+	if s.stats == nil {
+		s.stats = map[string]*RuleStat{}
+	}
+}
+
+// RuleStats returns the statistics collected for each rule, by name.
+// It is empty unless CollectRuleStats was called.
+func (s *Session) RuleStats() map[string]RuleStat {
+	stats := map[string]RuleStat{}
+	for name, stat := range s.stats {
+		stats[name] = *stat
+	}
+	return stats
+}
+
+// recordStats runs the parse function, adding to the statistics for
+// the named rule.
+func (s *Session) recordStats(name string, parse func() result.ParseResult) result.ParseResult {
+	stat, ok := s.stats[name]
+	if !ok {
+		stat = &RuleStat{}
+		s.stats[name] = stat
+	}
+	seeker := findSeeker(s.Scanner)
+	offset := 0
+	if seeker != nil {
+		offset = seeker.Offset()
+	}
+	started := time.Now()
+	r := parse()
+	stat.Calls++
+	stat.Duration += time.Since(started)
+	if seeker != nil && r.Matched() {
+		stat.Runes += seeker.Offset() - offset
+	}
+	return r
+}
+
+// SetCaseInsensitive sets whether the character matching parsers
+// (Char, CharRange, Token and the character set parsers) ignore case
+// in later calls to Parse. This is useful for case-insensitive
+// languages, where every keyword would otherwise need to allow each
+// case.
+func (s *Session) SetCaseInsensitive(ignore bool) {
+	s.ignoreCase = ignore
+}
+
+// matchFold returns whether the rune matches, or, if the scanner is
+// part of a case-insensitive session, whether any other case of the
+// rune matches.
+func matchFold(sc scanner.Scanner, r rune, match func(rune) bool) bool {
+	if match(r) {
+		return true
+	}
+	session := sessionOf(sc)
+	if session == nil || !session.ignoreCase {
+		return false
+	}
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if match(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionOf finds the session in a chain of wrapped scanners, if there
+// is one.
+func sessionOf(sc scanner.Scanner) *Session {
+	session, _ := findScanner(sc, func(s scanner.Scanner) bool {
+		_, ok := s.(*Session)
+		return ok
+	}).(*Session)
+	return session
+}
+
+// RuleParser is a named grammar rule.
+type RuleParser struct {
+	name  string
+	inner Parser
+}
+
+// Rule gives a name to a parser. When run as part of a Session (as
+// ParseString does), the result of a rule at each position is
+// memoized by name, so the rule is only evaluated once per position
+// no matter how many times the grammar tries it there. Rules must be
+// given distinct names.
+//
+// If a rule fails without getting past the first character, the error
+// is replaced with "expected <name>". Errors from further into the
+// input are kept as they are, since they are more specific.
+func Rule(name string, p Parser) Parser {
+	return &RuleParser{name: name, inner: p}
+}
+
+// Parse parses the input.
+func (p *RuleParser) Parse(sc scanner.Scanner) result.ParseResult {
+	session := sessionOf(sc)
+	if session == nil {
+		return p.parseLabeled(sc)
+	}
+	if session.stats != nil {
+		return session.recordStats(p.name, func() result.ParseResult {
+			return p.parseMemoized(sc, session)
+		})
+	}
+	return p.parseMemoized(sc, session)
+}
+
+// parseMemoized runs the rule, using the session's memoized result if
+// there is one. Results are only memoized when the rule runs directly
+// on the session: a wrapping scanner (like the ones used by Column and
+// UntilSentinel) can change what the rule matches, and others (like
+// the ones used by CollectCaptures and ParseEvents) collect side
+// effects that replaying a result would skip.
+func (p *RuleParser) parseMemoized(sc scanner.Scanner, session *Session) result.ParseResult {
+	if sc != scanner.Scanner(session) {
+		return p.parseLabeled(sc)
+	}
+	key := memoKey{rule: p.name, pos: sc.GetPos(), ignoreCase: session.ignoreCase}
+	if entry, ok := session.memo[key]; ok {
+		skipTo(sc, entry.offset, entry.end)
+		return entry.result
+	}
+
+	r := p.parseLabeled(sc)
+	session.memo[key] = memoEntry{result: r, end: sc.GetPos(), offset: offsetOf(sc)}
+	return r
+}
+
+// parseLabeled runs the inner parser, replacing the error with one
+// naming the rule if it failed right at the start. The scanner's
+// offset tells how far the inner parser read, so the error is only
+// kept if it read past the first rune, or if it rewound and the error
+// is from past the first rune. Without an offset there is no telling,
+// so the error is kept.
+func (p *RuleParser) parseLabeled(sc scanner.Scanner) result.ParseResult {
+	start := sc.GetPos()
+	seeker := findSeeker(sc)
+	if seeker == nil {
+		return p.inner.Parse(sc)
+	}
+	startOffset := seeker.Offset()
+	r := p.inner.Parse(sc)
+	if r.Matched() {
+		return r
+	}
+
+	var afterFirst textpos.TextPos
+	switch read := seeker.Offset() - startOffset; {
+	case read > 1:
+		return r
+	case read == 1:
+		afterFirst = sc.GetPos()
+	default:
+		sc.StartSnapshot()
+		sc.Read()
+		afterFirst = sc.GetPos()
+		sc.RewindSnapshot()
+	}
+	if afterFirst.Before(r.TextRange().End()) {
+		return r
+	}
+	return result.Failed(textpos.Single(start), fmt.Errorf("expected %s", p.name))
+}
+
+// seekerOf returns the scanner as a Seeker, looking through a Session
+// but not other wrappers, or nil if it can't seek. Other wrapping
+// scanners keep state of their own (like how many runes are left),
+// which seeking the underlying scanner would bypass.
+func seekerOf(sc scanner.Scanner) scanner.Seeker {
+	if session, ok := sc.(*Session); ok {
+		sc = session.Scanner
+	}
+	seeker, _ := sc.(scanner.Seeker)
+	return seeker
+}
+
+// offsetOf returns the scanner's offset, or 0 if it can't seek.
+func offsetOf(sc scanner.Scanner) int {
+	if seeker := seekerOf(sc); seeker != nil {
+		return seeker.Offset()
+	}
+	return 0
+}
+
+// skipTo moves the scanner forward to the given offset and position,
+// which were recorded with offsetOf and GetPos. It seeks if the scanner
+// can, since a TokenScanner can't be read one rune at a time, and
+// otherwise reads until it reaches the position.
+func skipTo(sc scanner.Scanner, offset int, pos textpos.TextPos) {
+	if seeker := seekerOf(sc); seeker != nil {
+		seeker.Seek(offset)
+		return
+	}
+	for sc.GetPos() != pos {
+		if _, err := sc.Read(); err != nil {
+			return
+		}
+	}
+}
+
+// MemoizedManyParser matches 0+ occurrences, remembering where the
+// inner parser failed.
+type MemoizedManyParser struct {
+	inner Parser
+}
+
+// MemoizedMany works like Many, but when run as part of a Session it
+// remembers the positions where the inner parser failed, and doesn't
+// try it there again. This helps when the grammar backtracks over the
+// repetition and the inner parser is expensive to fail.
+func MemoizedMany(inner Parser) Parser {
+	return &MemoizedManyParser{inner}
+}
+
+// Parse parses the input.
+func (p *MemoizedManyParser) Parse(sc scanner.Scanner) result.ParseResult {
+	session := sessionOf(sc)
+	start := sc.GetPos()
+	results := []interface{}{}
+
+	for {
+		before := sc.GetPos()
+		key := failureKey{parser: p, scanner: sc, pos: before}
+		if session != nil {
+			if session.failures[key] {
+				break
+			}
+		}
+
+		sc.StartSnapshot()
+		innerResult := p.inner.Parse(sc)
+		if !innerResult.Matched() {
+			sc.RewindSnapshot()
+			if session != nil {
+				session.failures[key] = true
+			}
+			break
+		}
+		// Stop on a match that consumed nothing, like Many does
+		if sc.GetPos() == before {
+			sc.RewindSnapshot()
+			break
+		}
+		sc.PopSnapshot()
+		results = append(results, innerResult.Result())
+	}
+
+	return result.Success(textpos.Range(start, sc.GetPos()), cleanupResult(results))
+}
@@ -0,0 +1,264 @@
+package parser_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmikkola/parsego/parser"
+	"github.com/jmikkola/parsego/parser/scanner"
+	"github.com/jmikkola/parsego/parser/textpos"
+)
+
+func TestRuleMemoized(t *testing.T) {
+	evaluated := 0
+	number := parser.Rule("number", parser.Lazy(func() parser.Parser {
+		evaluated++
+		return parser.Digits()
+	}))
+	p := parser.Or(
+		parser.Sequence(number, parser.Char('+'), number),
+		parser.Sequence(number, parser.Char('-'), number),
+		number)
+
+	result, err := parser.ParseString(p, "12-34")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "12-34", result)
+	assert.Equal(t, 2, evaluated, "Expected the rule to run once per position")
+
+	evaluated = 0
+	session := parser.NewSession("12")
+	result2, err2 := session.Parse(p)
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "12", result2)
+	assert.Equal(t, 1, evaluated, "Expected the rule to run once per position")
+
+	evaluated = 0
+	r := p.Parse(scanner.FromString("12"))
+	assert.True(t, r.Matched())
+	assert.Equal(t, 3, evaluated, "Expected no memoization outside a session")
+}
+
+func TestRuleKeepsCaptures(t *testing.T) {
+	rule := parser.Rule("num", parser.Named2("n", parser.Digits()))
+	p := parser.CollectCaptures(parser.Or(parser.Sequence(rule, parser.Char('!')), rule))
+
+	result, err := parser.ParseString(p, "12")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, map[string]interface{}{"n": "12"}, result)
+}
+
+func TestRuleUnderWrappers(t *testing.T) {
+	// The rule only matches "12" inside the column, so that result
+	// must not be replayed outside it
+	n := parser.Rule("n", parser.Digits())
+	p := parser.Or(parser.Sequence(parser.Column(0, 2, n), parser.Char('x')), n)
+
+	result, err := parser.ParseString(p, "1234")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "1234", result)
+}
+
+func TestRuleErrorLabel(t *testing.T) {
+	number := parser.Rule("number", parser.Digits())
+	pair := parser.Rule("pair", parser.Sequence(number, parser.Char(','), number))
+
+	_, err := parser.ParseString(pair, "x,1")
+	assert.Error(t, err, "Expected an error")
+	assert.Equal(t, "expected pair at line 0, col 0", err.Error())
+
+	_, err2 := parser.ParseString(pair, "12,x")
+	assert.Error(t, err2, "Expected an error")
+	assert.Equal(t, "expected number at line 0, col 3", err2.Error())
+
+	_, err3 := parser.ParseString(pair, "12;3")
+	assert.Error(t, err3, "Expected an error")
+	assert.Contains(t, err3.Error(), "expected a character in the range ',' to ','")
+
+	_, err4 := parser.ParseString(number, "\n1")
+	assert.EqualError(t, err4, "expected number at line 0, col 0")
+
+	value := parser.Rule("value", parser.Or(number, parser.Letter()))
+	_, err5 := parser.ParseString(value, "\n1")
+	assert.EqualError(t, err5, "expected value at line 0, col 0",
+		"Expected a rewound failure at the first rune to be labeled")
+
+	sc := scanner.FromString("x,1")
+	r := parser.Rule("not-x", parser.Not(parser.Char('x'))).Parse(sc)
+	assert.False(t, r.Matched())
+	assert.Equal(t, textpos.Pos(0, 0), sc.GetPos(), "Expected labeling not to consume input")
+}
+
+func TestCheckpoint(t *testing.T) {
+	input := "1,2,3,4,5"
+	item := parser.Sequence(parser.Digit(), parser.Maybe(parser.Char(',')))
+
+	first := parser.NewSession(input)
+	result1, err1 := first.Parse(parser.ManyCapped(item, 2, parser.OverflowStop))
+	assert.NoError(t, err1, "Expected successful parse")
+	assert.Equal(t, []interface{}{"1,", "2,"}, result1)
+	checkpoint := first.Checkpoint()
+	assert.Equal(t, parser.Checkpoint{Offset: 4}, checkpoint)
+
+	second := parser.NewSession(input)
+	second.ResumeFrom(checkpoint)
+	result2, err2 := second.Parse(parser.Sequence(parser.ListOf(item), parser.EOF()))
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, []interface{}{[]interface{}{"3,", "4,", "5"}, ""}, result2)
+}
+
+// backtrackingGrammar tries the repetition once per alternative. Each
+// time, the inner parser reads the whole run of letters at the end of
+// the input before failing.
+func backtrackingGrammar(many func(parser.Parser) parser.Parser, inner parser.Parser) parser.Parser {
+	repeated := many(inner)
+	alts := []parser.Parser{}
+	for _, c := range "1234567" {
+		alts = append(alts, parser.Sequence(repeated, parser.Char(c)))
+	}
+	alts = append(alts, parser.Sequence(repeated, parser.Many(parser.Letter()), parser.EOF()))
+	return parser.Or(alts...)
+}
+
+func backtrackingInput() string {
+	return strings.Repeat("x;", 10) + strings.Repeat("y", 1000)
+}
+
+func TestMemoizedMany(t *testing.T) {
+	evaluated := 0
+	inner := parser.Lazy(func() parser.Parser {
+		evaluated++
+		return parser.Sequence(parser.Many(parser.Letter()), parser.Char(';'))
+	})
+	input := backtrackingInput()
+
+	result, err := parser.ParseString(backtrackingGrammar(parser.Many, inner), input)
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, input, result)
+	assert.Equal(t, 8*11, evaluated)
+
+	evaluated = 0
+	result2, err2 := parser.ParseString(backtrackingGrammar(parser.MemoizedMany, inner), input)
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, input, result2)
+	assert.Equal(t, 8*10+1, evaluated, "Expected the failure to be tried only once")
+
+	evaluated = 0
+	p := parser.MemoizedMany(inner)
+	r := p.Parse(scanner.FromString(input))
+	assert.True(t, r.Matched())
+	r2 := p.Parse(scanner.FromString(input))
+	assert.True(t, r2.Matched())
+	assert.Equal(t, 2*11, evaluated, "Expected no memoization outside a session")
+}
+
+func TestMemoizedManyZeroWidth(t *testing.T) {
+	p := parser.Sequence(parser.MemoizedMany(parser.Maybe(parser.Char('a'))), parser.Char('b'))
+	result, err := parser.ParseString(p, "aab")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "aab", result)
+
+	result2, err2 := parser.ParseString(p, "b")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, "b", result2)
+}
+
+func TestMemoizedManyUnderWrappers(t *testing.T) {
+	// The repetition fails at "end" inside UntilSentinel, but not
+	// outside it, so the failure must not be replayed there
+	letters := parser.MemoizedMany(parser.Letter())
+	p := parser.Or(
+		parser.Sequence(parser.UntilSentinel("end", letters), parser.Char('!')),
+		letters)
+
+	result, err := parser.ParseString(p, "abend")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "abend", result)
+}
+
+func benchmarkBacktracking(b *testing.B, many func(parser.Parser) parser.Parser) {
+	inner := parser.Sequence(parser.Many(parser.Letter()), parser.Char(';'))
+	p := backtrackingGrammar(many, inner)
+	input := backtrackingInput()
+	for i := 0; i < b.N; i++ {
+		parser.ParseString(p, input)
+	}
+}
+
+func BenchmarkMany(b *testing.B) {
+	benchmarkBacktracking(b, parser.Many)
+}
+
+func BenchmarkMemoizedMany(b *testing.B) {
+	benchmarkBacktracking(b, parser.MemoizedMany)
+}
+
+func TestRuleStats(t *testing.T) {
+	var list parser.Parser
+	number := parser.Rule("number", parser.Digits())
+	item := parser.Rule("item", parser.Or(number, parser.Lazy(func() parser.Parser { return list })))
+	list = parser.Rule("list", parser.Surround(
+		parser.Char('('),
+		parser.ManySepBy(item, parser.Char(' ')),
+		parser.Char(')')))
+
+	session := parser.NewSession("(1 (22 3) ())")
+	session.CollectRuleStats()
+	_, err := session.Parse(list)
+	assert.NoError(t, err, "Expected successful parse")
+
+	stats := session.RuleStats()
+	// The empty list tries (and fails) to parse an item
+	assert.Equal(t, 4, stats["list"].Calls)
+	assert.Equal(t, 6, stats["item"].Calls)
+	assert.Equal(t, 6, stats["number"].Calls)
+	// Runes in nested lists are counted for each list
+	assert.Equal(t, 13+6+2, stats["list"].Runes)
+	assert.Equal(t, 4, stats["number"].Runes)
+
+	empty := parser.NewSession("(1)")
+	_, err2 := empty.Parse(list)
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Empty(t, empty.RuleStats(), "Expected no stats unless they are collected")
+}
+
+func TestSetCaseInsensitive(t *testing.T) {
+	keyword := parser.Sequence(parser.Token("select"), parser.Whitespace1(), parser.Char('x'),
+		parser.Whitespace1(), parser.AnyCharIn("fF"), parser.Token("rom"))
+
+	session := parser.NewSession("SeLeCt X FROM")
+	session.SetCaseInsensitive(true)
+	result, err := session.Parse(keyword)
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, "SeLeCt X FROM", result, "Expected the input's case to be kept")
+
+	_, err2 := parser.ParseString(keyword, "SeLeCt X FROM")
+	assert.Error(t, err2, "Expected case to matter by default")
+
+	off := parser.NewSession("select x from")
+	off.SetCaseInsensitive(false)
+	_, err3 := off.Parse(keyword)
+	assert.NoError(t, err3, "Expected successful parse")
+
+	ranged := parser.NewSession("Q")
+	ranged.SetCaseInsensitive(true)
+	result4, err4 := ranged.Parse(parser.LowerLetter())
+	assert.NoError(t, err4, "Expected successful parse")
+	assert.Equal(t, "Q", result4)
+
+	excluded := parser.NewSession("A")
+	excluded.SetCaseInsensitive(true)
+	_, err5 := excluded.Parse(parser.NoneOf('a'))
+	assert.Error(t, err5, "Expected NoneOf to exclude both cases")
+
+	rule := parser.Rule("select", parser.Token("select"))
+	toggled := parser.NewSession("SELECT")
+	_, err6 := toggled.Parse(rule)
+	assert.Error(t, err6, "Expected case to matter by default")
+	toggled.ResumeFrom(parser.Checkpoint{})
+	toggled.SetCaseInsensitive(true)
+	result7, err7 := toggled.Parse(rule)
+	assert.NoError(t, err7, "Expected the rule not to replay the case-sensitive result")
+	assert.Equal(t, "SELECT", result7)
+}
@@ -85,3 +85,11 @@ func (t TextPos) Advance(c rune) TextPos {
 	}
 	return t.AdvanceCol()
 }
+
+// Before returns whether this position comes before the other one.
+func (t TextPos) Before(other TextPos) bool {
+	if t.line != other.line {
+		return t.line < other.line
+	}
+	return t.col < other.col
+}
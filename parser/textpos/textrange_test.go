@@ -0,0 +1,16 @@
+package textpos_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmikkola/parsego/parser/textpos"
+)
+
+func TestBefore(t *testing.T) {
+	assert.True(t, textpos.Pos(0, 1).Before(textpos.Pos(0, 2)))
+	assert.True(t, textpos.Pos(0, 9).Before(textpos.Pos(1, 0)))
+	assert.False(t, textpos.Pos(1, 0).Before(textpos.Pos(0, 9)))
+	assert.False(t, textpos.Pos(2, 3).Before(textpos.Pos(2, 3)))
+}
@@ -0,0 +1,111 @@
+//go:build go1.18
+// +build go1.18
+
+package parser
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jmikkola/parsego/parser/result"
+	"github.com/jmikkola/parsego/parser/scanner"
+)
+
+// TypedParser is a Parser whose results are known to have the type T.
+// The typed combinators (MapT, OrT, SeqT, ManyT) keep track of result
+// types at compile time, so no type assertions are needed on their
+// results. A TypedParser is also a Parser, so it can be passed to the
+// untyped combinators too.
+type TypedParser[T any] struct {
+	inner Parser
+}
+
+// Typed wraps an untyped parser whose results have the type T. If the
+// parser returns a result of some other type, the parse fails.
+func Typed[T any](p Parser) TypedParser[T] {
+	return TypedParser[T]{p}
+}
+
+// Untyped returns the underlying untyped parser.
+func Untyped[T any](p TypedParser[T]) Parser {
+	return p.inner
+}
+
+// Parse parses the input.
+func (p TypedParser[T]) Parse(sc scanner.Scanner) result.ParseResult {
+	r := p.inner.Parse(sc)
+	if !r.Matched() {
+		return r
+	}
+	if _, ok := typedValue[T](r.Result()); !ok {
+		return result.Failed(r.TextRange(), fmt.Errorf(
+			"expected a result of type %v, got %T", reflect.TypeOf((*T)(nil)).Elem(), r.Result()))
+	}
+	return r
+}
+
+// typedValue converts a result to the type T. A nil result converts to
+// the zero value.
+func typedValue[T any](value interface{}) (T, bool) {
+	if value == nil {
+		var zero T
+		return zero, true
+	}
+	t, ok := value.(T)
+	return t, ok
+}
+
+// ParseStringT parses the text in a string, like ParseString, returning
+// a result of type T.
+func ParseStringT[T any](p TypedParser[T], str string) (T, error) {
+	value, err := ParseString(p, str)
+	t, _ := typedValue[T](value)
+	return t, err
+}
+
+// MapT returns a parser that converts the result of p with fn.
+func MapT[A, B any](p TypedParser[A], fn func(A) B) TypedParser[B] {
+	return Typed[B](ParseWith(p, func(value interface{}) interface{} {
+		a, _ := typedValue[A](value)
+		return fn(a)
+	}))
+}
+
+// OrT works like Or, for typed parsers with the same result type.
+func OrT[T any](parsers ...TypedParser[T]) TypedParser[T] {
+	untyped := make([]Parser, len(parsers))
+	for i, p := range parsers {
+		untyped[i] = p
+	}
+	return Typed[T](Or(untyped...))
+}
+
+// Both is the result of SeqT.
+type Both[A, B any] struct {
+	First  A
+	Second B
+}
+
+// SeqT parses first and then second, returning both results.
+func SeqT[A, B any](first TypedParser[A], second TypedParser[B]) TypedParser[Both[A, B]] {
+	return Typed[Both[A, B]](Map([]Named{
+		{"first", first},
+		{"second", second},
+	}, func(m map[string]interface{}) interface{} {
+		a, _ := typedValue[A](m["first"])
+		b, _ := typedValue[B](m["second"])
+		return Both[A, B]{First: a, Second: b}
+	}))
+}
+
+// ManyT works like ListOf, returning a slice of typed results.
+func ManyT[T any](p TypedParser[T]) TypedParser[[]T] {
+	return Typed[[]T](ParseWith(ListOf(p), func(values interface{}) interface{} {
+		list := values.([]interface{})
+		out := make([]T, len(list))
+		for i, value := range list {
+			out[i], _ = typedValue[T](value)
+		}
+		return out
+	}))
+}
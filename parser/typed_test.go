@@ -0,0 +1,59 @@
+//go:build go1.18
+// +build go1.18
+
+package parser_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jmikkola/parsego/parser"
+)
+
+// typedSum parses sums and differences of integers, like "1+20-3",
+// without any type assertions.
+func typedSum() parser.TypedParser[int] {
+	number := parser.MapT(parser.Typed[string](parser.Digits()), func(digits string) int {
+		n, _ := strconv.Atoi(digits)
+		return n
+	})
+	plus := parser.MapT(parser.Typed[string](parser.Char('+')), func(string) int { return 1 })
+	minus := parser.MapT(parser.Typed[string](parser.Char('-')), func(string) int { return -1 })
+	term := parser.SeqT(parser.OrT(plus, minus), number)
+
+	return parser.MapT(parser.SeqT(number, parser.ManyT(term)), func(sum parser.Both[int, []parser.Both[int, int]]) int {
+		total := sum.First
+		for _, t := range sum.Second {
+			total += t.First * t.Second
+		}
+		return total
+	})
+}
+
+func TestTypedParser(t *testing.T) {
+	p := typedSum()
+
+	result, err := parser.ParseStringT(p, "1+20-3")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, 18, result)
+
+	result2, err2 := parser.ParseStringT(p, "7")
+	assert.NoError(t, err2, "Expected successful parse")
+	assert.Equal(t, 7, result2)
+
+	_, err3 := parser.ParseStringT(p, "x")
+	assert.Error(t, err3, "Expected an error")
+}
+
+func TestTypedAdapters(t *testing.T) {
+	untyped := parser.Untyped(typedSum())
+	result, err := parser.ParseString(parser.ListOf(parser.Surround(parser.Whitespace(), untyped, parser.Whitespace())), "1+1 2-1")
+	assert.NoError(t, err, "Expected successful parse")
+	assert.Equal(t, []interface{}{2, 1}, result)
+
+	wrong := parser.Typed[int](parser.Digits())
+	_, err2 := parser.ParseStringT(wrong, "12")
+	assert.EqualError(t, err2, "expected a result of type int, got string at line 0, col 2")
+}